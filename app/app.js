@@ -206,6 +206,9 @@ async function getVideos() {
       const listItem = document.createElement('li');
       listItem.textContent = video.title;
       listItem.onclick = () => videoStateHandler(video.id);
+      if (video.preview_url) {
+        addHoverPreview(listItem, video.preview_url);
+      }
       videoList.appendChild(listItem);
     }
   } catch (error) {
@@ -213,6 +216,28 @@ async function getVideos() {
   }
 }
 
+// Play the video's short muted preview while the pointer is over it.
+function addHoverPreview(listItem, previewURL) {
+  let preview = null;
+  listItem.addEventListener('mouseenter', () => {
+    preview = document.createElement('video');
+    preview.src = previewURL;
+    preview.muted = true;
+    preview.loop = true;
+    preview.autoplay = true;
+    preview.playsInline = true;
+    preview.style.display = 'block';
+    preview.style.width = '160px';
+    listItem.appendChild(preview);
+  });
+  listItem.addEventListener('mouseleave', () => {
+    if (preview) {
+      preview.remove();
+      preview = null;
+    }
+  });
+}
+
 function createVideoStateHandler() {
   let currentVideoID = null;
 
@@ -266,16 +291,32 @@ function viewVideo(video) {
 
   const videoPlayer = document.getElementById('video-player');
   if (videoPlayer) {
-    if (!video.video_url) {
+    // Prefer the adaptive stream where the browser can play HLS natively.
+    const canPlayHLS = videoPlayer.canPlayType('application/vnd.apple.mpegurl') !== '';
+    const src = (canPlayHLS && video.hls_playlist_url) || video.video_url;
+    if (!src) {
       videoPlayer.style.display = 'none';
     } else {
       videoPlayer.style.display = 'block';
-      videoPlayer.src = video.video_url;
+      videoPlayer.src = src;
+      setCaptionTracks(videoPlayer, video.captions || []);
       videoPlayer.load();
     }
   }
 }
 
+function setCaptionTracks(videoPlayer, captions) {
+  videoPlayer.querySelectorAll('track').forEach((track) => track.remove());
+  for (const caption of captions) {
+    const track = document.createElement('track');
+    track.kind = caption.kind;
+    track.srclang = caption.language;
+    track.label = caption.label;
+    track.src = caption.url;
+    videoPlayer.appendChild(track);
+  }
+}
+
 async function deleteVideo() {
   if (!currentVideo) {
     alert('No video selected for deletion.');
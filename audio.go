@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+// Videos can also be published as audio only, for listening like a podcast.
+// The audio is normalized to a consistent loudness so episodes play back at
+// the same volume.
+
+const (
+	audioRenditionNone = "none"
+	audioRenditionAAC  = "aac"
+	audioRenditionMP3  = "mp3"
+
+	audioBitrate = "128k"
+	// loudnormFilter targets -16 LUFS, the usual loudness for podcasts.
+	loudnormFilter = "loudnorm=I=-16:TP=-1.5:LRA=11"
+)
+
+// audioFormat is how an audio rendition is encoded and stored.
+type audioFormat struct {
+	Ext         string
+	ContentType string
+	Container   string
+	Codec       string
+	SampleRate  string
+	Args        []string
+}
+
+var audioFormats = map[string]audioFormat{
+	audioRenditionAAC: {
+		Ext:         ".m4a",
+		ContentType: "audio/mp4",
+		Container:   "ipod",
+		Codec:       "aac",
+		SampleRate:  "48000",
+		Args:        []string{"-movflags", "+faststart"},
+	},
+	audioRenditionMP3: {
+		Ext:         ".mp3",
+		ContentType: "audio/mpeg",
+		Container:   "mp3",
+		Codec:       "libmp3lame",
+		SampleRate:  "44100",
+	},
+}
+
+// storeAudioRendition encodes the first audio stream of the video at
+// sourcePath as cfg.audioRendition and uploads it to baseKey plus the
+// format's extension, returning its key.
+func (cfg *apiConfig) storeAudioRendition(ctx context.Context, sourcePath, baseKey string) (string, error) {
+	format := audioFormats[cfg.audioRendition]
+
+	out, err := os.CreateTemp(cfg.processingDir, "audio-*"+format.Ext)
+	if err != nil {
+		return "", err
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+
+	// loudnorm resamples to 192kHz internally, so the output rate is set
+	// explicitly.
+	args := []string{"-vn", "-map", "0:a:0", "-af", loudnormFilter, "-ar", format.SampleRate, "-ac", "2", "-b:a", audioBitrate}
+	err = cfg.media.Transcode(ctx, sourcePath, out.Name(), media.TranscodeOptions{
+		Format:     format.Container,
+		AudioCodec: format.Codec,
+		Args:       append(args, format.Args...),
+	})
+	if err != nil {
+		return "", fmt.Errorf("couldn't encode audio rendition: %w", err)
+	}
+
+	f, err := os.Open(out.Name())
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	key := baseKey + format.Ext
+	if err := cfg.videoStore.Put(ctx, key, f, format.ContentType); err != nil {
+		return "", fmt.Errorf("couldn't upload audio rendition: %w", err)
+	}
+	return key, nil
+}
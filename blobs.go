@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"path"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// Uploaded videos and thumbnails are stored by content: a file identical to
+// one already in the store is not stored again, and the existing object is
+// referenced instead. Objects are only deleted once nothing refers to them.
+
+// blobHasher hashes and counts what is written to it, so that content can be
+// identified while it is copied somewhere else.
+type blobHasher struct {
+	hash hash.Hash
+	size int64
+}
+
+func newBlobHasher() *blobHasher {
+	return &blobHasher{hash: sha256.New()}
+}
+
+func (h *blobHasher) Write(p []byte) (int, error) {
+	h.size += int64(len(p))
+	return h.hash.Write(p)
+}
+
+// Sum returns the hex encoded SHA-256 of everything written so far.
+func (h *blobHasher) Sum() string {
+	return hex.EncodeToString(h.hash.Sum(nil))
+}
+
+// storeBlob uploads body to store at key, hashing it on the way. Content
+// identical to an object already in the store is referenced rather than
+// kept twice; if the caller knows its hash already, such content isn't
+// uploaded at all. It returns the key the content is stored at, which is key
+// only if it wasn't there already.
+func (cfg *apiConfig) storeBlob(ctx context.Context, store storage.Store, key string, body io.Reader, contentType, knownHash string) (string, error) {
+	if knownHash != "" {
+		existing, err := cfg.db.ReferenceBlob(store.Bucket(), knownHash)
+		if err != nil {
+			return "", fmt.Errorf("couldn't look up blob: %w", err)
+		}
+		if existing != nil {
+			return existing.Key, nil
+		}
+	}
+
+	hasher := newBlobHasher()
+	if err := store.Put(ctx, key, io.TeeReader(body, hasher), contentType); err != nil {
+		return "", err
+	}
+	blob, err := cfg.db.AcquireBlob(store.Bucket(), hasher.Sum(), key, hasher.size)
+	if err != nil {
+		store.Delete(context.Background(), key)
+		return "", fmt.Errorf("couldn't record blob: %w", err)
+	}
+	if blob.Key != key {
+		// The same content was stored already, or concurrently and
+		// recorded first.
+		if err := store.Delete(context.Background(), key); err != nil {
+			log.Printf("Couldn't delete duplicate %s: %v", key, err)
+		}
+	}
+	return blob.Key, nil
+}
+
+// releaseBlob drops the reference ref holds on its object in store, deleting
+// the object if it was the last one. Objects that weren't stored with
+// storeBlob are never deleted.
+func (cfg *apiConfig) releaseBlob(store storage.Store, ref *string) {
+	if ref == nil {
+		return
+	}
+	bucket, key, ok := parseStorageRef(*ref)
+	if !ok || bucket != store.Bucket() {
+		return
+	}
+	unreferenced, err := cfg.db.ReleaseBlob(bucket, key)
+	if err != nil {
+		log.Printf("Couldn't release %s: %v", key, err)
+		return
+	}
+	if !unreferenced {
+		return
+	}
+	if err := store.Delete(context.Background(), key); err != nil {
+		log.Printf("Couldn't delete %s: %v", key, err)
+	}
+}
+
+// releaseReplacedBlob releases old if it has been replaced by new. The new
+// reference was taken by storeBlob, so old is released even when both refer
+// to the same object.
+func (cfg *apiConfig) releaseReplacedBlob(store storage.Store, old, new *string) {
+	if old == nil || old == new {
+		return
+	}
+	cfg.releaseBlob(store, old)
+}
+
+// releaseVideoObjects releases the objects previous refers to that video no
+// longer does. Renditions are stored under keys unique to the run that made
+// them, so unlike blobs they are deleted outright.
+func (cfg *apiConfig) releaseVideoObjects(previous, video database.Video) {
+	cfg.releaseReplacedBlob(cfg.videoStore, previous.VideoURL, video.VideoURL)
+	cfg.releaseReplacedBlob(cfg.videoStore, previous.OriginalURL, video.OriginalURL)
+	cfg.releaseReplacedBlob(cfg.videoStore, previous.MasterURL, video.MasterURL)
+
+	// Playlists and manifests share a prefix with their segments.
+	cfg.deleteReplacedObjects(previous.HLSPlaylistURL, video.HLSPlaylistURL, true)
+	cfg.deleteReplacedObjects(previous.DASHManifestURL, video.DASHManifestURL, true)
+	cfg.deleteReplacedObjects(previous.AudioURL, video.AudioURL, false)
+	cfg.deleteReplacedObjects(previous.PreviewURL, video.PreviewURL, false)
+	cfg.deleteReplacedObjects(previous.StoryboardURL, video.StoryboardURL, false)
+	cfg.deleteReplacedObjects(previous.StoryboardSpriteURL, video.StoryboardSpriteURL, false)
+}
+
+// deleteReplacedObjects deletes the object old refers to if it has been
+// replaced by new, along with everything next to it when withSiblings is set.
+func (cfg *apiConfig) deleteReplacedObjects(old, new *string, withSiblings bool) {
+	if old == nil || old == new {
+		return
+	}
+	bucket, key, ok := parseStorageRef(*old)
+	if !ok || bucket != cfg.videoStore.Bucket() {
+		return
+	}
+
+	keys := []string{key}
+	if withSiblings {
+		objects, err := cfg.videoStore.List(context.Background(), path.Dir(key)+"/")
+		if err != nil {
+			log.Printf("Couldn't list objects next to %s: %v", key, err)
+			return
+		}
+		keys = keys[:0]
+		for _, object := range objects {
+			keys = append(keys, object.Key)
+		}
+	}
+	for _, key := range keys {
+		if err := cfg.videoStore.Delete(context.Background(), key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Couldn't delete %s: %v", key, err)
+		}
+	}
+}
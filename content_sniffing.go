@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// Uploads are validated by looking at their bytes rather than the
+// Content-Type the client declared.
+
+// sniffLen is how many leading bytes content sniffing looks at.
+const sniffLen = 512
+
+var errContentMismatch = errors.New("file contents don't match the declared type")
+
+// mp4Brands are the ftyp major brands of MP4 video files.
+var mp4Brands = []string{
+	"isom", "iso2", "iso3", "iso4", "iso5", "iso6",
+	"mp41", "mp42", "avc1", "dash", "mmp4", "msnv", "f4v ",
+	"M4V ", "M4VH", "M4VP", "XAVC",
+}
+
+// detectContentType identifies a file from its leading bytes. ISO base media
+// files are told apart by the major brand in their ftyp box and Matroska
+// files by their DocType, neither of which http.DetectContentType fully
+// understands; everything else is left to http.DetectContentType.
+func detectContentType(head []byte) string {
+	if bytes.HasPrefix(head, []byte("\x1A\x45\xDF\xA3")) {
+		// An EBML header, whose DocType element says which format it is.
+		switch {
+		case bytes.Contains(head, []byte("webm")):
+			return "video/webm"
+		case bytes.Contains(head, []byte("matroska")):
+			return "video/x-matroska"
+		}
+	}
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		brand := string(head[8:12])
+		switch {
+		case brand == "qt  ":
+			return "video/quicktime"
+		case slices.Contains(mp4Brands, brand):
+			return "video/mp4"
+		}
+	}
+	contentType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return contentType
+}
+
+func sniffFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return sniffReader(f)
+}
+
+func sniffObject(ctx context.Context, store storage.Store, key string) (string, error) {
+	body, _, err := store.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	return sniffReader(body)
+}
+
+func sniffReader(r io.Reader) (string, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return detectContentType(head[:n]), nil
+}
+
+// videoDemuxers maps the video content types we accept to the ffprobe
+// demuxer that reads them.
+var videoDemuxers = map[string]string{
+	"video/mp4":        "mp4",
+	"video/quicktime":  "mov",
+	"video/webm":       "webm",
+	"video/x-matroska": "matroska",
+}
+
+// videoExtensions maps the video content types we accept to the extension
+// objects of that type are stored with.
+var videoExtensions = map[string]string{
+	"video/mp4":        ".mp4",
+	"video/quicktime":  ".mov",
+	"video/webm":       ".webm",
+	"video/x-matroska": ".mkv",
+}
+
+const supportedVideoTypesMessage = "File type not supported - please use MP4, MOV, WebM or MKV"
+
+func isSupportedVideoType(contentType string) bool {
+	_, ok := videoDemuxers[contentType]
+	return ok
+}
+
+// matchesDeclaredType reports whether a detected content type agrees with
+// the one a client declared. WebM is a subset of Matroska and clients label
+// the two interchangeably, so either is accepted for the other.
+func matchesDeclaredType(declared, detected string) bool {
+	if declared == detected {
+		return true
+	}
+	matroska := []string{"video/webm", "video/x-matroska"}
+	return slices.Contains(matroska, declared) && slices.Contains(matroska, detected)
+}
+
+// validateVideoFile checks that the file at path really is a video of a
+// supported type, and of the declared type if one is given: its leading
+// bytes must say so, and probing must be able to read it with the matching
+// demuxer.
+func (cfg *apiConfig) validateVideoFile(ctx context.Context, path, declared string) error {
+	detected, err := sniffFile(path)
+	if err != nil {
+		return err
+	}
+	if !isSupportedVideoType(detected) || (declared != "" && !matchesDeclaredType(declared, detected)) {
+		return fmt.Errorf("%w: detected %s", errContentMismatch, detected)
+	}
+
+	info, err := cfg.media.Probe(ctx, path)
+	if errors.Is(err, media.ErrUnreadable) || errors.Is(err, media.ErrNoVideoStream) {
+		return fmt.Errorf("%w: %v", errContentMismatch, err)
+	}
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(info.Formats, videoDemuxers[detected]) {
+		return fmt.Errorf("%w: container is %s", errContentMismatch, strings.Join(info.Formats, ","))
+	}
+	return nil
+}
+
+// validateVideoObject checks that a video uploaded straight to the video
+// store starts with the bytes of a supported video type. The full ffprobe
+// check happens when the video is processed.
+func (cfg *apiConfig) validateVideoObject(ctx context.Context, key string) error {
+	detected, err := sniffObject(ctx, cfg.videoStore, key)
+	if err != nil {
+		return err
+	}
+	if !isSupportedVideoType(detected) {
+		return fmt.Errorf("%w: detected %s", errContentMismatch, detected)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+const dashManifest = "manifest.mpd"
+
+// transcodeAndStoreDASH encodes the video at sourcePath into a DASH ladder of
+// cfg.videoRenditions with fragmented MP4 segments and uploads the manifest
+// and segments under keyPrefix. It returns the manifest's key.
+func (cfg *apiConfig) transcodeAndStoreDASH(ctx context.Context, sourcePath, keyPrefix string) (string, error) {
+	err := cfg.transcodeLadder(ctx, sourcePath, keyPrefix, "DASH", dashOptions)
+	if err != nil {
+		return "", err
+	}
+	return keyPrefix + "/" + dashManifest, nil
+}
+
+// dashOptions builds a single transcode that writes every rendition as a
+// representation of one video adaptation set. Audio is encoded once, at the
+// largest rendition's bitrate, into its own adaptation set.
+func dashOptions(outDir string, renditions []videoRendition, info media.Info) (string, media.TranscodeOptions) {
+	args := []string{}
+
+	for i, r := range renditions {
+		args = append(args, "-map", fmt.Sprintf("[v%d]", i))
+		args = append(args, encoderBitrateArgs(i, r)...)
+	}
+	adaptationSets := "id=0,streams=v"
+	if info.HasAudio {
+		args = append(args, "-map", "0:a:0", "-b:a:0", fmt.Sprintf("%dk", renditions[0].AudioBitrate))
+		adaptationSets += " id=1,streams=a"
+	}
+
+	args = append(args, encoderArgs(info)...)
+	args = append(args,
+		"-seg_duration", fmt.Sprint(segmentSeconds),
+		"-use_template", "1",
+		"-use_timeline", "1",
+		"-adaptation_sets", adaptationSets,
+		"-init_seg_name", "init-$RepresentationID$.m4s",
+		"-media_seg_name", "chunk-$RepresentationID$-$Number%05d$.m4s",
+	)
+	return filepath.Join(outDir, dashManifest), media.TranscodeOptions{
+		Format: "dash",
+		Filter: scaleFilter(renditions, info),
+		Args:   args,
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/captions"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/google/uuid"
+)
+
+// storeEmbeddedCaptions extracts each text subtitle stream of the video at
+// sourcePath as a WebVTT caption track. Tracks the user uploaded win over
+// embedded ones in the same language, and embedded tracks left from an
+// earlier upload are removed. Like thumbnails, captions aren't worth failing
+// the video over, so errors are only logged.
+func (cfg *apiConfig) storeEmbeddedCaptions(ctx context.Context, videoID uuid.UUID, sourcePath string, info media.Info) {
+	existing, err := cfg.db.GetCaptions(videoID)
+	if err != nil {
+		log.Printf("Couldn't get captions of video %s: %v", videoID, err)
+		return
+	}
+	uploaded := map[string]bool{}
+	for _, caption := range existing {
+		if caption.Source == database.CaptionSourceUpload {
+			uploaded[caption.Language] = true
+		}
+	}
+
+	dir, err := os.MkdirTemp(cfg.processingDir, "captions-*")
+	if err != nil {
+		log.Printf("Couldn't extract captions of video %s: %v", videoID, err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	stored := map[string]bool{}
+	for _, stream := range info.Subtitles {
+		if !stream.IsText() {
+			continue
+		}
+		language := embeddedCaptionLanguage(stream, stored)
+		if uploaded[language] {
+			continue
+		}
+
+		vtt, err := cfg.extractSubtitles(ctx, sourcePath, dir, stream)
+		if err != nil {
+			log.Printf("Couldn't extract subtitle stream %d of video %s: %v", stream.Index, videoID, err)
+			continue
+		}
+
+		label := stream.Title
+		if label == "" {
+			label = language
+		}
+		kind := "subtitles"
+		if stream.HearingImpaired {
+			kind = "captions"
+		}
+		err = cfg.storeCaption(ctx, database.Caption{
+			VideoID:  videoID,
+			Language: language,
+			Label:    label,
+			Kind:     kind,
+			Source:   database.CaptionSourceEmbedded,
+		}, vtt)
+		if err != nil {
+			log.Printf("Couldn't save subtitle stream %d of video %s: %v", stream.Index, videoID, err)
+			continue
+		}
+		stored[language] = true
+	}
+
+	for _, caption := range existing {
+		if caption.Source != database.CaptionSourceEmbedded || stored[caption.Language] {
+			continue
+		}
+		deleted, err := cfg.db.DeleteCaption(videoID, caption.Language)
+		if err != nil {
+			log.Printf("Couldn't delete old captions of video %s: %v", videoID, err)
+			continue
+		}
+		if deleted != nil {
+			cfg.deleteCaptionObject(*deleted)
+		}
+	}
+}
+
+// extractSubtitles converts a subtitle stream to WebVTT.
+func (cfg *apiConfig) extractSubtitles(ctx context.Context, sourcePath, dir string, stream media.SubtitleStream) ([]byte, error) {
+	outPath := filepath.Join(dir, fmt.Sprintf("%d.vtt", stream.Index))
+	err := cfg.media.Transcode(ctx, sourcePath, outPath, media.TranscodeOptions{
+		Format: "webvtt",
+		Args:   []string{"-map", fmt.Sprintf("0:%d", stream.Index), "-c:s", "webvtt"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		return nil, err
+	}
+	return captions.ToWebVTT(data)
+}
+
+// embeddedCaptionLanguage picks the language a subtitle stream is stored
+// under: its own tag, "und" if it has none, and a private use suffix naming
+// the stream if an earlier stream already took that language.
+func embeddedCaptionLanguage(stream media.SubtitleStream, taken map[string]bool) string {
+	language := stream.Language
+	if language == "" || !languagePattern.MatchString(language) {
+		language = "und"
+	}
+	if taken[language] {
+		language = fmt.Sprintf("%s-x-s%d", language, stream.Index)
+	}
+	return language
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/captions"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const maxCaptionUploadSize = 5 << 20
+
+// languagePattern accepts BCP 47 style tags such as "en", "pt-BR" or
+// "zh-Hant".
+var languagePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{1,8})*$`)
+
+// captionKinds are the text track kinds a caption can be played as.
+var captionKinds = []string{"captions", "subtitles", "descriptions"}
+
+func (cfg *apiConfig) handlerCaptionUpload(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	language := r.PathValue("language")
+	if !languagePattern.MatchString(language) {
+		respondWithError(w, http.StatusBadRequest, "Language must be a language tag such as en or pt-BR", nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxCaptionUploadSize)
+	if err := r.ParseMultipartForm(maxCaptionUploadSize); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse multipart form", err)
+		return
+	}
+	file, _, err := r.FormFile("captions")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse file", err)
+		return
+	}
+	defer file.Close()
+
+	kind := r.FormValue("kind")
+	if kind == "" {
+		kind = "captions"
+	}
+	if !slices.Contains(captionKinds, kind) {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Kind must be one of %v", captionKinds), nil)
+		return
+	}
+	label := r.FormValue("label")
+	if label == "" {
+		label = language
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read file", err)
+		return
+	}
+	vtt, err := captions.ToWebVTT(data)
+	if errors.Is(err, captions.ErrInvalidCaptions) {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Captions must be an SRT or WebVTT file", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't convert captions", err)
+		return
+	}
+
+	err = cfg.storeCaption(r.Context(), database.Caption{
+		VideoID:  video.ID,
+		Language: language,
+		Label:    label,
+		Kind:     kind,
+		Source:   database.CaptionSourceUpload,
+	}, vtt)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save captions", err)
+		return
+	}
+
+	cfg.respondWithVideo(w, r, http.StatusOK, video.ID)
+}
+
+func (cfg *apiConfig) handlerCaptionDelete(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := cfg.db.DeleteCaption(video.ID, r.PathValue("language"))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete captions", err)
+		return
+	}
+	if deleted == nil {
+		respondWithError(w, http.StatusNotFound, "Video has no captions in that language", nil)
+		return
+	}
+	cfg.deleteCaptionObject(*deleted)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// storeCaption uploads a WebVTT track to the video store and records it as
+// caption, replacing the video's track in the same language.
+func (cfg *apiConfig) storeCaption(ctx context.Context, caption database.Caption, vtt []byte) error {
+	// A fresh key for every upload, so cached copies of a replaced track
+	// are never served.
+	keySuffix := make([]byte, 16)
+	rand.Read(keySuffix)
+	key := fmt.Sprintf("captions/%s/%s-%s.vtt", caption.VideoID, caption.Language, base64.RawURLEncoding.EncodeToString(keySuffix))
+
+	if err := cfg.videoStore.Put(ctx, key, bytes.NewReader(vtt), "text/vtt"); err != nil {
+		return err
+	}
+
+	caption.URL = storageRef(cfg.videoStore.Bucket(), key)
+	replaced, err := cfg.db.SetCaption(caption)
+	if err != nil {
+		cfg.deleteCaptionObject(caption)
+		return err
+	}
+	if replaced != nil {
+		cfg.deleteCaptionObject(*replaced)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) deleteCaptionObject(caption database.Caption) {
+	_, key, ok := parseStorageRef(caption.URL)
+	if !ok {
+		return
+	}
+	if err := cfg.videoStore.Delete(context.Background(), key); err != nil {
+		log.Printf("Couldn't delete captions %s: %v", key, err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+func (cfg *apiConfig) handlerCDNCookies(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	_, err = auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	if cfg.cfSigner == nil {
+		respondWithError(w, http.StatusNotFound, "CloudFront signing is not configured", nil)
+		return
+	}
+
+	expiresAt := time.Now().Add(cfg.videoURLExpiry).UTC()
+	resource := fmt.Sprintf("https://%s/*", cfg.s3CfDistribution)
+	cookies, err := cfg.cfSigner.SignedCookies(resource, expiresAt)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign CloudFront cookies", err)
+		return
+	}
+
+	for _, cookie := range cookies {
+		cookie.Domain = cfg.cfCookieDomain
+		cookie.Path = "/"
+		cookie.Expires = expiresAt
+		cookie.Secure = true
+		cookie.HttpOnly = true
+		cookie.SameSite = http.SameSiteNoneMode
+		http.SetCookie(w, cookie)
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		ExpiresAt: expiresAt,
+	})
+}
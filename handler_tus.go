@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// tus 1.0 resumable uploads (https://tus.io/protocols/resumable-upload)
+// with the creation, termination and expiration extensions. Chunks are
+// appended to a file in tusDir; once the last byte arrives the file is queued
+// for the same processing pipeline as handlerUploadVideo.
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,expiration"
+)
+
+// tusLocks serializes PATCH requests per upload so two requests can't write
+// at the same offset.
+var tusLocks sync.Map
+
+func tusLock(id uuid.UUID) *sync.Mutex {
+	mu, _ := tusLocks.LoadOrStore(id, &sync.Mutex{})
+	return mu.(*sync.Mutex)
+}
+
+func (cfg *apiConfig) tusFilePath(id uuid.UUID) string {
+	return filepath.Join(cfg.tusDir, id.String())
+}
+
+func setTusHeaders(w http.ResponseWriter) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// checkTusRequest validates the protocol version and authenticates the
+// request, responding with an error and returning false if either fails.
+func (cfg *apiConfig) checkTusRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	setTusHeaders(w)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		respondWithError(w, http.StatusPreconditionFailed, "Unsupported tus version", nil)
+		return uuid.Nil, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return uuid.Nil, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// getTusUpload loads the upload named in the path and checks that userID
+// owns it and that it hasn't expired.
+func (cfg *apiConfig) getTusUpload(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (database.TusUpload, bool) {
+	uploadID, err := uuid.Parse(r.PathValue("uploadID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Upload not found", err)
+		return database.TusUpload{}, false
+	}
+
+	upload, err := cfg.db.GetTusUpload(uploadID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload", err)
+		return database.TusUpload{}, false
+	}
+	if upload.ID == uuid.Nil || upload.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Upload not found", nil)
+		return database.TusUpload{}, false
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		respondWithError(w, http.StatusGone, "Upload has expired", nil)
+		return database.TusUpload{}, false
+	}
+	return upload, true
+}
+
+func (cfg *apiConfig) handlerTusOptions(w http.ResponseWriter, r *http.Request) {
+	setTusHeaders(w)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.Itoa(maxVideoUploadSize))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerTusCreate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.checkTusRequest(w, r)
+	if !ok {
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 1 {
+		respondWithError(w, http.StatusBadRequest, "Upload-Length must be a positive integer", err)
+		return
+	}
+	if length > maxVideoUploadSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Upload is too large", nil)
+		return
+	}
+
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Metadata", err)
+		return
+	}
+	fileType := ""
+	if declared, ok := metadata["filetype"]; ok {
+		fileType, _, err = mime.ParseMediaType(declared)
+		if err != nil {
+			respondWithError(w, http.StatusUnsupportedMediaType, "Error checking file type.", err)
+			return
+		}
+		if !isSupportedVideoType(fileType) {
+			respondWithError(w, http.StatusUnsupportedMediaType, supportedVideoTypesMessage, nil)
+			return
+		}
+	}
+
+	videoID, err := uuid.Parse(metadata["video_id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Upload-Metadata must include a video_id", err)
+		return
+	}
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "User does not own rights to this video.", nil)
+		return
+	}
+	if !cfg.startVideoUpload(w, video) {
+		return
+	}
+
+	upload, err := cfg.db.CreateTusUpload(database.CreateTusUploadParams{
+		VideoID:   videoID,
+		UserID:    userID,
+		Length:    length,
+		ExpiresAt: time.Now().Add(cfg.tusExpiry).UTC(),
+		FileType:  fileType,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload", err)
+		return
+	}
+
+	file, err := os.Create(cfg.tusFilePath(upload.ID))
+	if err != nil {
+		cfg.db.DeleteTusUpload(upload.ID)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload", err)
+		return
+	}
+	file.Close()
+
+	w.Header().Set("Location", fmt.Sprintf("/api/tus/%s", upload.ID))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (cfg *apiConfig) handlerTusHead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.checkTusRequest(w, r)
+	if !ok {
+		return
+	}
+	upload, ok := cfg.getTusUpload(w, r, userID)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (cfg *apiConfig) handlerTusPatch(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.checkTusRequest(w, r)
+	if !ok {
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream", nil)
+		return
+	}
+
+	upload, ok := cfg.getTusUpload(w, r, userID)
+	if !ok {
+		return
+	}
+
+	mu := tusLock(upload.ID)
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Reload now that we hold the lock; another PATCH may have moved the offset.
+	upload, err := cfg.db.GetTusUpload(upload.ID)
+	if err != nil || upload.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Upload not found", err)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Upload-Offset must be an integer", err)
+		return
+	}
+	if offset != upload.Offset {
+		respondWithError(w, http.StatusConflict, "Upload-Offset doesn't match the current offset", nil)
+		return
+	}
+
+	file, err := os.OpenFile(cfg.tusFilePath(upload.ID), os.O_WRONLY, 0644)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open upload", err)
+		return
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open upload", err)
+		return
+	}
+
+	// Whatever arrives before the connection drops is kept, so the client can
+	// resume from the new offset.
+	written, copyErr := io.Copy(file, io.LimitReader(r.Body, upload.Length-offset))
+	upload.Offset += written
+	if err := cfg.db.UpdateTusUploadOffset(upload.ID, upload.Offset); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save upload offset", err)
+		return
+	}
+	if copyErr != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read upload chunk", copyErr)
+		return
+	}
+
+	if upload.Offset == upload.Length {
+		err := cfg.finishTusUpload(r.Context(), upload)
+		if errors.Is(err, errContentMismatch) {
+			respondWithError(w, http.StatusUnsupportedMediaType, "Uploaded file isn't a supported video", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't queue video for processing.", err)
+			return
+		}
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// finishTusUpload moves a fully received upload out of tusDir and queues it
+// for processing. Uploads that turn out not to be supported videos, or not of
+// the type declared in their metadata, are discarded.
+func (cfg *apiConfig) finishTusUpload(ctx context.Context, upload database.TusUpload) error {
+	video, err := cfg.db.GetVideo(upload.VideoID)
+	if err != nil {
+		return err
+	}
+	if video.ID == uuid.Nil {
+		return fmt.Errorf("video %s no longer exists", upload.VideoID)
+	}
+
+	if err := cfg.validateVideoFile(ctx, cfg.tusFilePath(upload.ID), upload.FileType); err != nil {
+		if errors.Is(err, errContentMismatch) {
+			cfg.deleteTusUpload(upload.ID)
+			cfg.cancelVideoUpload(upload.VideoID)
+		}
+		return err
+	}
+
+	sourceFile, err := cfg.newProcessingFile()
+	if err != nil {
+		return err
+	}
+	sourceFile.Close()
+	if err := os.Rename(cfg.tusFilePath(upload.ID), sourceFile.Name()); err != nil {
+		os.Remove(sourceFile.Name())
+		return err
+	}
+
+	if err := cfg.enqueueVideoProcessing(video, processVideoPayload{SourcePath: sourceFile.Name()}); err != nil {
+		// Put the file back so the client can retry the final PATCH.
+		os.Rename(sourceFile.Name(), cfg.tusFilePath(upload.ID))
+		return err
+	}
+	return cfg.deleteTusUpload(upload.ID)
+}
+
+func (cfg *apiConfig) handlerTusDelete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.checkTusRequest(w, r)
+	if !ok {
+		return
+	}
+	upload, ok := cfg.getTusUpload(w, r, userID)
+	if !ok {
+		return
+	}
+
+	mu := tusLock(upload.ID)
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := cfg.deleteTusUpload(upload.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete upload", err)
+		return
+	}
+	cfg.cancelVideoUpload(upload.VideoID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) deleteTusUpload(id uuid.UUID) error {
+	if err := os.Remove(cfg.tusFilePath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := cfg.db.DeleteTusUpload(id); err != nil {
+		return err
+	}
+	tusLocks.Delete(id)
+	return nil
+}
+
+// cleanupExpiredTusUploads periodically removes uploads that were never
+// finished before their Upload-Expires deadline.
+func (cfg *apiConfig) cleanupExpiredTusUploads(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		uploads, err := cfg.db.GetExpiredTusUploads(time.Now().UTC())
+		if err != nil {
+			log.Printf("Couldn't list expired tus uploads: %v", err)
+			continue
+		}
+		for _, upload := range uploads {
+			if err := cfg.deleteTusUpload(upload.ID); err != nil {
+				log.Printf("Couldn't delete expired tus upload %s: %v", upload.ID, err)
+				continue
+			}
+			cfg.cancelVideoUpload(upload.VideoID)
+		}
+	}
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma separated pairs
+// of a key and an optional base64 encoded value.
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if header == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("empty metadata key")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("metadata value for %q is not base64: %w", key, err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
@@ -1,46 +1,28 @@
 package main
 
 import (
-	"crypto/rand"
-	"encoding/base64"
-	"fmt"
+	"errors"
 	"io"
 	"mime"
 	"net/http"
-	"os"
-	"path/filepath"
 
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
-	"github.com/google/uuid"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/imaging"
 )
 
-func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
-		return
-	}
-
-	// Authenticate
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
+const maxThumbnailUploadSize = 20 << 20 // 20 megabytes
 
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Request) {
+	videoData, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
 		return
 	}
 
-	fmt.Println("uploading thumbnail for video", videoID, "by user", userID)
+	r.Body = http.MaxBytesReader(w, r.Body, maxThumbnailUploadSize)
 
 	// Parse multipart form data
 	const maxMemory = 10 << 20 // 10 megabytes
 	if err := r.ParseMultipartForm(maxMemory); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't parse multipart form", err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse multipart form", err)
 		return
 	}
 
@@ -57,67 +39,45 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 	typeCheck, _, err := mime.ParseMediaType(mediaType)
 	if err != nil {
 		respondWithError(w, http.StatusUnsupportedMediaType, "Error checking file type.", err)
+		return
 	}
 	if typeCheck != "image/jpeg" && typeCheck != "image/png" {
 		respondWithError(w, http.StatusUnsupportedMediaType, "File type not supported - please use JPEG or PNG", nil)
 		return
 	}
 
-	var fileExt string
-	switch typeCheck {
-	case "image/jpeg":
-		fileExt = "jpg"
-	case "image/png":
-		fileExt = "png"
-	}
-
-	thumbnailID := make([]byte, 32)
-	rand.Read(thumbnailID)
-
-	thumbnailIDString := base64.RawURLEncoding.EncodeToString(thumbnailID)
-
-	localFilePath := fmt.Sprintf("%s.%s", thumbnailIDString, fileExt)
-	rootFilePath := filepath.Join(cfg.assetsRoot, localFilePath)
-
-	// Create empty file for thumbnail
-	tnFile, err := os.Create(rootFilePath)
+	data, err := io.ReadAll(file)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't save file", err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't read file", err)
 		return
 	}
 
-	// Use io to fill newly created file with image data.
-	_, err = io.Copy(tnFile, file)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error saving image to file.", err)
+	// Decode the image rather than trusting the declared type, and store
+	// re-encoded copies at each standard size.
+	img, format, err := imaging.Decode(data)
+	if errors.Is(err, imaging.ErrTooLarge) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Image dimensions are too large", err)
+		return
 	}
-
-	// Retrieve video to be updated
-	videoData, err := cfg.db.GetVideo(videoID)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Video not found", err)
+		respondWithError(w, http.StatusUnsupportedMediaType, "Couldn't decode image - please use JPEG or PNG", err)
 		return
 	}
-	if videoData.UserID != userID {
-		respondWithError(w, http.StatusUnauthorized, "User not authorized to retreive this video.", err)
+	if imaging.ContentType(format) != typeCheck {
+		respondWithError(w, http.StatusUnsupportedMediaType, "File contents don't match its declared type", nil)
+		return
 	}
 
-	// Store file path for image file location
-	dataURL := fmt.Sprintf("http://localhost:%s/assets/%s.%s", cfg.port, thumbnailIDString, fileExt)
-	
-	videoData.ThumbnailURL = &dataURL
+	variants, err := cfg.storeThumbnail(r.Context(), videoData.ID, img, format)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving image to file.", err)
+		return
+	}
 
-	// Update database with image file path
-	if err := cfg.db.UpdateVideo(videoData); err != nil {
+	if err := cfg.setThumbnail(videoData.ID, variants); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't update video metadata.", err)
-	}
-	
-//TODO: maybe modify error message. It could be misleading here as this is not the auth step.
-	updatedVideo, err := cfg.db.GetVideo(videoID)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "User not authorized to retrieve this video", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, updatedVideo)
+	cfg.respondWithVideo(w, r, http.StatusOK, videoData.ID)
 }
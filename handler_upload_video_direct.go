@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	directUploadExpiry = 15 * time.Minute
+	directUploadPrefix = "uploads/"
+)
+
+var errUploadTooLarge = errors.New("uploaded video is too large")
+
+// directUploadKey is where a client uploads the raw video, either directly
+// or in parts, before it is processed into its final location.
+func directUploadKey(videoID uuid.UUID) string {
+	return directUploadPrefix + videoID.String()
+}
+
+func (cfg *apiConfig) handlerUploadVideoPresign(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Method      string `json:"method"`
+		ContentType string `json:"content_type"`
+		Size        int64  `json:"size"`
+	}
+	type response struct {
+		Method    string            `json:"method"`
+		URL       string            `json:"url"`
+		Fields    map[string]string `json:"fields,omitempty"`
+		ExpiresAt time.Time         `json:"expires_at"`
+	}
+
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	if !isSupportedVideoType(params.ContentType) {
+		respondWithError(w, http.StatusUnsupportedMediaType, supportedVideoTypesMessage, nil)
+		return
+	}
+	if params.Size <= 0 || params.Size > maxVideoUploadSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Video size must be between 1 and %d bytes", maxVideoUploadSize), nil)
+		return
+	}
+
+	presigner, ok := cfg.videoStore.(storage.UploadPresigner)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, "Video storage doesn't support direct uploads", nil)
+		return
+	}
+
+	key := directUploadKey(video.ID)
+	resp := response{
+		Method:    params.Method,
+		ExpiresAt: time.Now().Add(directUploadExpiry).UTC(),
+	}
+	switch params.Method {
+	case http.MethodPut:
+		resp.URL, err = presigner.PresignPut(r.Context(), key, params.ContentType, params.Size, directUploadExpiry)
+	case http.MethodPost:
+		var post storage.PresignedPost
+		post, err = presigner.PresignPost(r.Context(), key, params.ContentType, maxVideoUploadSize, directUploadExpiry)
+		resp.URL = post.URL
+		resp.Fields = post.Fields
+	default:
+		respondWithError(w, http.StatusBadRequest, "Method must be PUT or POST", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't presign upload", err)
+		return
+	}
+	if !cfg.startVideoUpload(w, video) {
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerUploadVideoComplete(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.enqueueStagedUpload(r.Context(), video)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusBadRequest, "No uploaded video found", err)
+		return
+	}
+	if errors.Is(err, errUploadTooLarge) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Uploaded video is too large", err)
+		return
+	}
+	if errors.Is(err, errContentMismatch) {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Uploaded file isn't a supported video", err)
+		return
+	}
+	if errors.Is(err, database.ErrInvalidVideoTransition) {
+		respondWithError(w, http.StatusConflict, "Video isn't being uploaded", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't queue video for processing.", err)
+		return
+	}
+
+	cfg.respondWithVideo(w, r, http.StatusAccepted, video.ID)
+}
+
+// enqueueStagedUpload checks the video a client uploaded to directUploadKey
+// and queues it for processing.
+func (cfg *apiConfig) enqueueStagedUpload(ctx context.Context, video database.Video) error {
+	key := directUploadKey(video.ID)
+	obj, err := cfg.videoStore.Head(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if obj.Size > maxVideoUploadSize {
+		cfg.videoStore.Delete(ctx, key)
+		return errUploadTooLarge
+	}
+	if err := cfg.validateVideoObject(ctx, key); err != nil {
+		if errors.Is(err, errContentMismatch) {
+			cfg.videoStore.Delete(ctx, key)
+		}
+		return err
+	}
+
+	return cfg.enqueueVideoProcessing(video, processVideoPayload{SourceKey: key})
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// Resumable uploads: a client initiates a multipart upload for a video,
+// uploads numbered parts (retrying any that fail), lists the parts the
+// server already has after an interruption, and finally completes or aborts
+// the upload. Only one upload per video can be in progress.
+
+const maxUploadParts = 10000
+
+type multipartUploadResponse struct {
+	UploadID string         `json:"upload_id"`
+	PartSize int64          `json:"part_size"`
+	Parts    []storage.Part `json:"parts"`
+}
+
+func (cfg *apiConfig) multipartUploader(w http.ResponseWriter) (storage.MultipartUploader, bool) {
+	uploader, ok := cfg.videoStore.(storage.MultipartUploader)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, "Video storage doesn't support multipart uploads", nil)
+	}
+	return uploader, ok
+}
+
+// getMultipartUpload loads the upload in progress for video, responding with
+// 404 if there is none.
+func (cfg *apiConfig) getMultipartUpload(w http.ResponseWriter, video database.Video) (database.MultipartUpload, bool) {
+	upload, err := cfg.db.GetMultipartUpload(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload", err)
+		return database.MultipartUpload{}, false
+	}
+	if upload.UploadID == "" {
+		respondWithError(w, http.StatusNotFound, "No upload in progress for this video", nil)
+		return database.MultipartUpload{}, false
+	}
+	return upload, true
+}
+
+func (cfg *apiConfig) handlerMultipartCreate(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+	uploader, ok := cfg.multipartUploader(w)
+	if !ok {
+		return
+	}
+	if !cfg.startVideoUpload(w, video) {
+		return
+	}
+	// The video only stays uploading while an upload is recorded for it.
+	recorded := false
+	defer func() {
+		if !recorded {
+			cfg.cancelVideoUpload(video.ID)
+		}
+	}()
+
+	existing, err := cfg.db.GetMultipartUpload(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload", err)
+		return
+	}
+	if existing.UploadID != "" {
+		recorded = true
+		// Initiating again resumes the upload already in progress.
+		parts, err := uploader.ListParts(r.Context(), existing.ObjectKey, existing.UploadID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't list uploaded parts", err)
+			return
+		}
+		if err == nil {
+			respondWithJSON(w, http.StatusOK, multipartUploadResponse{
+				UploadID: existing.UploadID,
+				PartSize: cfg.partSize,
+				Parts:    parts,
+			})
+			return
+		}
+		// The storage backend no longer knows the upload; start over.
+		if err := cfg.db.DeleteMultipartUpload(video.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't reset upload", err)
+			return
+		}
+		recorded = false
+	}
+
+	key := directUploadKey(video.ID)
+	uploadID, err := uploader.CreateMultipartUpload(r.Context(), key, "application/octet-stream")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload", err)
+		return
+	}
+
+	upload, err := cfg.db.CreateMultipartUpload(database.MultipartUpload{
+		VideoID:   video.ID,
+		UploadID:  uploadID,
+		ObjectKey: key,
+	})
+	if err != nil {
+		uploader.AbortMultipartUpload(r.Context(), key, uploadID)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save upload", err)
+		return
+	}
+	recorded = true
+
+	respondWithJSON(w, http.StatusCreated, multipartUploadResponse{
+		UploadID: upload.UploadID,
+		PartSize: cfg.partSize,
+		Parts:    []storage.Part{},
+	})
+}
+
+func (cfg *apiConfig) handlerMultipartUploadPart(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+	uploader, ok := cfg.multipartUploader(w)
+	if !ok {
+		return
+	}
+
+	partNumber, err := strconv.Atoi(r.PathValue("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > maxUploadParts {
+		respondWithError(w, http.StatusBadRequest, "Part number must be between 1 and 10000", err)
+		return
+	}
+
+	upload, ok := cfg.getMultipartUpload(w, video)
+	if !ok {
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, cfg.partSize)
+	data, err := io.ReadAll(body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "Part is larger than the part size", err)
+			return
+		}
+		respondWithError(w, http.StatusBadRequest, "Couldn't read part", err)
+		return
+	}
+	if len(data) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Part is empty", nil)
+		return
+	}
+
+	part, err := uploader.UploadPart(r.Context(), upload.ObjectKey, upload.UploadID, int32(partNumber), bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't upload part", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, part)
+}
+
+func (cfg *apiConfig) handlerMultipartList(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+	uploader, ok := cfg.multipartUploader(w)
+	if !ok {
+		return
+	}
+	upload, ok := cfg.getMultipartUpload(w, video)
+	if !ok {
+		return
+	}
+
+	parts, err := uploader.ListParts(r.Context(), upload.ObjectKey, upload.UploadID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list uploaded parts", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, multipartUploadResponse{
+		UploadID: upload.UploadID,
+		PartSize: cfg.partSize,
+		Parts:    parts,
+	})
+}
+
+func (cfg *apiConfig) handlerMultipartComplete(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+	uploader, ok := cfg.multipartUploader(w)
+	if !ok {
+		return
+	}
+	upload, ok := cfg.getMultipartUpload(w, video)
+	if !ok {
+		return
+	}
+
+	parts, err := uploader.ListParts(r.Context(), upload.ObjectKey, upload.UploadID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list uploaded parts", err)
+		return
+	}
+	if len(parts) == 0 {
+		respondWithError(w, http.StatusBadRequest, "No parts have been uploaded", nil)
+		return
+	}
+	for i, part := range parts {
+		if part.Number != int32(i+1) {
+			respondWithError(w, http.StatusBadRequest, "Uploaded parts are not contiguous", nil)
+			return
+		}
+		// Which part is the last isn't known until now, and only it may be
+		// smaller than the storage backend's minimum.
+		if i < len(parts)-1 && part.Size < storage.MinPartSize {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Part %d is smaller than the minimum part size of %d bytes; only the last part may be smaller", part.Number, storage.MinPartSize), nil)
+			return
+		}
+	}
+
+	err = uploader.CompleteMultipartUpload(r.Context(), upload.ObjectKey, upload.UploadID, parts)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't complete upload", err)
+		return
+	}
+	if err := cfg.db.DeleteMultipartUpload(video.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't complete upload", err)
+		return
+	}
+
+	err = cfg.enqueueStagedUpload(r.Context(), video)
+	if errors.Is(err, errUploadTooLarge) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Uploaded video is too large", err)
+		return
+	}
+	if errors.Is(err, errContentMismatch) {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Uploaded file isn't a supported video", err)
+		return
+	}
+	if errors.Is(err, database.ErrInvalidVideoTransition) {
+		respondWithError(w, http.StatusConflict, "Video isn't being uploaded", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't queue video for processing.", err)
+		return
+	}
+
+	cfg.respondWithVideo(w, r, http.StatusAccepted, video.ID)
+}
+
+func (cfg *apiConfig) handlerMultipartAbort(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+	uploader, ok := cfg.multipartUploader(w)
+	if !ok {
+		return
+	}
+	upload, ok := cfg.getMultipartUpload(w, video)
+	if !ok {
+		return
+	}
+
+	err := uploader.AbortMultipartUpload(r.Context(), upload.ObjectKey, upload.UploadID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't abort upload", err)
+		return
+	}
+	if err := cfg.db.DeleteMultipartUpload(video.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't abort upload", err)
+		return
+	}
+	cfg.cancelVideoUpload(video.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// newTestConfig returns a config with in-memory storage and the fake media
+// tool, so the whole upload flow runs without AWS or ffmpeg.
+func newTestConfig(t *testing.T) *apiConfig {
+	t.Helper()
+	db, err := database.NewClient(filepath.Join(t.TempDir(), "tubely.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &apiConfig{
+		db:                 db,
+		videoStore:         storage.NewMemoryStore("http://localhost/media"),
+		assetStore:         storage.NewMemoryStore("http://localhost/assets"),
+		jwtSecret:          "secret",
+		videoURLExpiry:     time.Minute,
+		processingDir:      t.TempDir(),
+		jobMaxAttempts:     1,
+		jobTimeout:         time.Minute,
+		jobsWake:           make(chan struct{}, 1),
+		outputFormats:      []string{outputFormatMP4},
+		audioRendition:     audioRenditionNone,
+		thumbnailMode:      thumbnailModeTimestamp,
+		thumbnailTimestamp: time.Second,
+		media:              media.NewFake(),
+	}
+}
+
+// mp4Header is enough of an MP4 for the upload to be sniffed as one; the
+// fake media tool takes care of the rest.
+func mp4Header() []byte {
+	data := make([]byte, 512)
+	copy(data, "\x00\x00\x00\x18ftypisom\x00\x00\x02\x00isomiso2")
+	return data
+}
+
+// newTestVideo creates a user and a draft video of theirs, returning the
+// video and a token for the user.
+func newTestVideo(t *testing.T, cfg *apiConfig) (database.Video, string) {
+	t.Helper()
+	user, err := cfg.db.CreateUser(database.CreateUserParams{Email: "user@example.com", Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := cfg.db.CreateVideo(database.CreateVideoParams{Title: "Test", Description: "A test video", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return video, token
+}
+
+// uploadTestVideo uploads mp4Header as video's file and returns the response.
+func uploadTestVideo(t *testing.T, cfg *apiConfig, video database.Video, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="video"; filename="video.mp4"`)
+	header.Set("Content-Type", "video/mp4")
+	part, err := form.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(mp4Header())
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/video_upload/"+video.ID.String(), &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.SetPathValue("videoID", video.ID.String())
+	rec := httptest.NewRecorder()
+	cfg.handlerUploadVideo(rec, req)
+	return rec
+}
+
+// runQueuedJob runs the next queued job in place of a worker.
+func runQueuedJob(t *testing.T, cfg *apiConfig) {
+	t.Helper()
+	job, err := cfg.db.ClaimJob(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID == uuid.Nil {
+		t.Fatal("upload didn't queue a job")
+	}
+	cfg.runJob(context.Background(), job)
+}
+
+func TestUploadVideoIsProcessedToReady(t *testing.T) {
+	cfg := newTestConfig(t)
+	video, token := newTestVideo(t, cfg)
+
+	rec := uploadTestVideo(t, cfg, video, token)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("upload status = %d, want %d: %s", rec.Code, http.StatusAccepted, rec.Body)
+	}
+	var accepted database.Video
+	if err := json.NewDecoder(rec.Body).Decode(&accepted); err != nil {
+		t.Fatal(err)
+	}
+	if accepted.Status != database.VideoStatusProcessing {
+		t.Errorf("status after upload = %q, want %q", accepted.Status, database.VideoStatusProcessing)
+	}
+
+	runQueuedJob(t, cfg)
+
+	processed, err := cfg.db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processed.Status != database.VideoStatusReady {
+		t.Fatalf("status after processing = %q (%v), want %q", processed.Status, processed.StatusError, database.VideoStatusReady)
+	}
+	if processed.VideoURL == nil {
+		t.Fatal("processed video has no video URL")
+	}
+	bucket, key, ok := parseStorageRef(*processed.VideoURL)
+	if !ok || bucket != cfg.videoStore.Bucket() {
+		t.Fatalf("video URL = %q, want a reference into the video store", *processed.VideoURL)
+	}
+	if _, err := cfg.videoStore.Head(context.Background(), key); err != nil {
+		t.Errorf("video wasn't stored at %s: %v", key, err)
+	}
+	if processed.Metadata.Width == nil || *processed.Metadata.Width != media.FakeInfo.Width {
+		t.Errorf("width = %v, want %d", processed.Metadata.Width, media.FakeInfo.Width)
+	}
+	if processed.ThumbnailURL == nil || len(processed.ThumbnailVariants) == 0 {
+		t.Error("processed video has no thumbnail")
+	}
+}
+
+// deletingTool is the fake media tool, except that the first call to method
+// deletes the video being processed, as if its owner deleted it midway.
+type deletingTool struct {
+	*media.Fake
+	method string
+	delete func()
+	once   sync.Once
+}
+
+func (d *deletingTool) called(method string) {
+	if method == d.method {
+		d.once.Do(d.delete)
+	}
+}
+
+func (d *deletingTool) Remux(ctx context.Context, src, dst string, opts media.RemuxOptions) error {
+	d.called("Remux")
+	return d.Fake.Remux(ctx, src, dst, opts)
+}
+
+func (d *deletingTool) ExtractFrame(ctx context.Context, src, dst string, opts media.FrameOptions) error {
+	d.called("ExtractFrame")
+	return d.Fake.ExtractFrame(ctx, src, dst, opts)
+}
+
+func TestVideoDeletedWhileProcessing(t *testing.T) {
+	// Remux makes the MP4, before the video is checked for; ExtractFrame
+	// makes the thumbnail, after.
+	for _, method := range []string{"Remux", "ExtractFrame"} {
+		t.Run(method, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			video, token := newTestVideo(t, cfg)
+			cfg.media = &deletingTool{
+				Fake:   media.NewFake(),
+				method: method,
+				delete: func() {
+					req := httptest.NewRequest(http.MethodDelete, "/api/videos/"+video.ID.String(), nil)
+					req.Header.Set("Authorization", "Bearer "+token)
+					req.SetPathValue("videoID", video.ID.String())
+					rec := httptest.NewRecorder()
+					cfg.handlerVideoMetaDelete(rec, req)
+					if rec.Code != http.StatusNoContent {
+						t.Errorf("delete status = %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body)
+					}
+				},
+			}
+
+			if rec := uploadTestVideo(t, cfg, video, token); rec.Code != http.StatusAccepted {
+				t.Fatalf("upload status = %d, want %d: %s", rec.Code, http.StatusAccepted, rec.Body)
+			}
+			runQueuedJob(t, cfg)
+
+			// Nothing the run stored is left behind, and the job isn't retried.
+			for name, store := range map[string]storage.Store{"video": cfg.videoStore, "asset": cfg.assetStore} {
+				objects, err := store.List(context.Background(), "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, object := range objects {
+					t.Errorf("%s store still has %s", name, object.Key)
+				}
+			}
+			job, err := cfg.db.ClaimJob(time.Now().Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job.ID != uuid.Nil {
+				t.Errorf("job for deleted video was retried")
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+// clipPayload names the range of a stored video a new video is cut from.
+type clipPayload struct {
+	SourceKey string  `json:"source_key"`
+	Start     float64 `json:"start"`
+	End       float64 `json:"end"`
+}
+
+// handlerVideoClip creates a new video from the range between start and end,
+// in seconds, of one of the caller's ready videos. The clip is cut and then
+// processed like any upload.
+func (cfg *apiConfig) handlerVideoClip(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Start       float64 `json:"start"`
+		End         float64 `json:"end"`
+		Title       string  `json:"title"`
+		Description string  `json:"description"`
+	}
+
+	source, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Start < 0 || params.End <= params.Start {
+		respondWithError(w, http.StatusBadRequest, "Clip must end after it starts", nil)
+		return
+	}
+	if source.Metadata.Duration != nil && params.End > *source.Metadata.Duration {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Clip can't end after the video does, at %.3f seconds", *source.Metadata.Duration), nil)
+		return
+	}
+
+	if source.Status != database.VideoStatusReady {
+		respondWithError(w, http.StatusConflict, "Video can't be clipped while it is "+string(source.Status), nil)
+		return
+	}
+	// Cut from the original when it was kept, as it hasn't been re-encoded
+	// or watermarked.
+	sourceRef := source.MasterURL
+	if sourceRef == nil {
+		sourceRef = source.OriginalURL
+	}
+	if sourceRef == nil {
+		sourceRef = source.VideoURL
+	}
+	if sourceRef == nil {
+		respondWithError(w, http.StatusConflict, "Video has no stored file to clip", nil)
+		return
+	}
+	sourceBucket, sourceKey, ok := parseStorageRef(*sourceRef)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't find video file", nil)
+		return
+	}
+
+	if params.Title == "" {
+		params.Title = source.Title + " (clip)"
+	}
+	if params.Description == "" {
+		params.Description = source.Description
+	}
+	clip, err := cfg.db.CreateVideo(database.CreateVideoParams{
+		Title:       params.Title,
+		Description: params.Description,
+		UserID:      source.UserID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create video", err)
+		return
+	}
+
+	// Hold a reference to the source until the clip job is done with it, so
+	// it survives the source video being deleted or replaced meanwhile.
+	referenced, err := cfg.db.ReferenceBlobByKey(sourceBucket, sourceKey)
+	if err != nil {
+		cfg.db.DeleteVideo(clip.ID)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't queue clip for processing", err)
+		return
+	}
+	if !referenced {
+		// Files stored before blobs were tracked could be deleted under the
+		// job; uploading the video again stores its file as a blob.
+		cfg.db.DeleteVideo(clip.ID)
+		respondWithError(w, http.StatusConflict, "Video must be uploaded again before it can be clipped", nil)
+		return
+	}
+
+	// The clip's source is in place already, so it passes straight through
+	// uploading.
+	err = cfg.db.TransitionVideoStatus(clip.ID, database.VideoStatusUploading, "")
+	if err == nil {
+		err = cfg.enqueueVideoProcessing(clip, processVideoPayload{
+			Clip: &clipPayload{SourceKey: sourceKey, Start: params.Start, End: params.End},
+		})
+	}
+	if err != nil {
+		cfg.releaseBlob(cfg.videoStore, sourceRef)
+		cfg.db.DeleteVideo(clip.ID)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't queue clip for processing", err)
+		return
+	}
+
+	cfg.respondWithVideo(w, r, http.StatusAccepted, clip.ID)
+}
+
+// cutClip downloads the clip's source video and cuts the clip's range out of
+// it into a new file in processingDir, returning its path. When the range
+// starts on a keyframe the streams are copied; otherwise the video has to be
+// re-encoded for the clip to start on the right frame.
+func (cfg *apiConfig) cutClip(ctx context.Context, clip clipPayload) (string, error) {
+	sourcePath, _, err := cfg.downloadToTemp(ctx, clip.SourceKey)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(sourcePath)
+
+	info, err := cfg.media.Probe(ctx, sourcePath)
+	if err != nil {
+		return "", fmt.Errorf("couldn't probe video: %w", err)
+	}
+	keyframes, err := cfg.media.Keyframes(ctx, sourcePath)
+	if err != nil {
+		return "", fmt.Errorf("couldn't find keyframes: %w", err)
+	}
+
+	out, err := os.CreateTemp(cfg.processingDir, "clip-*.mkv")
+	if err != nil {
+		return "", err
+	}
+	out.Close()
+
+	start := secondsToDuration(clip.Start)
+	end := secondsToDuration(clip.End)
+	// Matroska holds any codec the source may have been uploaded in.
+	if startsOnKeyframe(start, keyframes, info.FrameRate) {
+		err = cfg.media.Remux(ctx, sourcePath, out.Name(), media.RemuxOptions{
+			Format:      "matroska",
+			VideoStream: info.VideoStream,
+			Start:       start,
+			End:         end,
+		})
+	} else {
+		err = cfg.media.Transcode(ctx, sourcePath, out.Name(), media.TranscodeOptions{
+			Format:     "matroska",
+			VideoCodec: "libx264",
+			AudioCodec: "aac",
+			Args: []string{
+				"-map", fmt.Sprintf("0:%d", info.VideoStream), "-map", "0:a:0?",
+				"-preset", "veryfast", "-crf", "18", "-pix_fmt", "yuv420p",
+				"-b:a", "192k",
+			},
+			Start: start,
+			End:   end,
+		})
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", fmt.Errorf("couldn't cut clip: %w", err)
+	}
+	return out.Name(), nil
+}
+
+// startsOnKeyframe reports whether start falls within half a frame of one of
+// keyframes.
+func startsOnKeyframe(start time.Duration, keyframes []time.Duration, frameRate float64) bool {
+	if start == 0 {
+		return true
+	}
+	tolerance := 20 * time.Millisecond
+	if frameRate > 0 {
+		tolerance = secondsToDuration(0.5 / frameRate)
+	}
+	for _, keyframe := range keyframes {
+		if (keyframe - start).Abs() <= tolerance {
+			return true
+		}
+	}
+	return false
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
 	"github.com/google/uuid"
 )
 
@@ -72,15 +76,60 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = cfg.db.DeleteVideo(videoID)
+	cfg.discardPendingUploads(r.Context(), videoID)
+	// Processing may have stored more since the video was read, so what is
+	// released is what the video had when it was deleted.
+	deleted, err := cfg.db.DeleteVideo(videoID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
 		return
 	}
+	cfg.releaseVideoObjects(deleted, database.Video{})
+	cfg.releaseThumbnailVariants(deleted.ThumbnailVariants)
+	for _, caption := range deleted.Captions {
+		cfg.deleteCaptionObject(caption)
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// discardPendingUploads removes the files behind a video's unfinished
+// uploads and queued jobs, which are only recorded in rows deleted with the
+// video. Running jobs clean up after themselves once they find it gone.
+func (cfg *apiConfig) discardPendingUploads(ctx context.Context, videoID uuid.UUID) {
+	jobs, err := cfg.db.GetQueuedVideoJobs(videoID)
+	if err != nil {
+		log.Printf("Couldn't get jobs of video %s: %v", videoID, err)
+	}
+	for _, job := range jobs {
+		var payload processVideoPayload
+		if err := json.Unmarshal([]byte(job.Payload), &payload); err == nil {
+			cfg.cleanupJobSource(payload)
+		}
+	}
+
+	tusUploads, err := cfg.db.GetVideoTusUploads(videoID)
+	if err != nil {
+		log.Printf("Couldn't get tus uploads of video %s: %v", videoID, err)
+	}
+	for _, upload := range tusUploads {
+		if err := cfg.deleteTusUpload(upload.ID); err != nil {
+			log.Printf("Couldn't delete tus upload %s: %v", upload.ID, err)
+		}
+	}
+
+	multipartUpload, err := cfg.db.GetMultipartUpload(videoID)
+	if err != nil {
+		log.Printf("Couldn't get multipart upload of video %s: %v", videoID, err)
+	}
+	if uploader, ok := cfg.videoStore.(storage.MultipartUploader); ok && multipartUpload.UploadID != "" {
+		err := uploader.AbortMultipartUpload(ctx, multipartUpload.ObjectKey, multipartUpload.UploadID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Couldn't abort multipart upload of video %s: %v", videoID, err)
+		}
+	}
+}
+
 func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
@@ -95,7 +144,13 @@ func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, video)
+	signedVideo, err := cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URL", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, signedVideo)
 }
 
 func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
@@ -116,5 +171,13 @@ func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	for i, video := range videos {
+		videos[i], err = cfg.dbVideoToSignedVideo(r.Context(), video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URL", err)
+			return
+		}
+	}
+
 	respondWithJSON(w, http.StatusOK, videos)
 }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+const (
+	hlsMasterPlaylist  = "master.m3u8"
+	hlsVariantPlaylist = "playlist.m3u8"
+)
+
+// transcodeAndStoreHLS encodes the video at sourcePath into an HLS ladder of
+// cfg.videoRenditions and uploads the master playlist, variant playlists and
+// segments under keyPrefix. It returns the master playlist's key.
+func (cfg *apiConfig) transcodeAndStoreHLS(ctx context.Context, sourcePath, keyPrefix string) (string, error) {
+	err := cfg.transcodeLadder(ctx, sourcePath, keyPrefix, "HLS", hlsOptions)
+	if err != nil {
+		return "", err
+	}
+	return keyPrefix + "/" + hlsMasterPlaylist, nil
+}
+
+// hlsOptions builds a single transcode that scales the source once per
+// rendition and writes each as a variant stream, named after the rendition,
+// plus a master playlist listing them all.
+func hlsOptions(outDir string, renditions []videoRendition, info media.Info) (string, media.TranscodeOptions) {
+	args := []string{}
+	streamMap := []string{}
+	for i, r := range renditions {
+		args = append(args, "-map", fmt.Sprintf("[v%d]", i))
+		args = append(args, encoderBitrateArgs(i, r)...)
+		if info.HasAudio {
+			args = append(args, "-map", "0:a:0", fmt.Sprintf("-b:a:%d", i), fmt.Sprintf("%dk", r.AudioBitrate))
+			streamMap = append(streamMap, fmt.Sprintf("v:%d,a:%d,name:%s", i, i, r.Name))
+		} else {
+			streamMap = append(streamMap, fmt.Sprintf("v:%d,name:%s", i, r.Name))
+		}
+	}
+
+	args = append(args, encoderArgs(info)...)
+	args = append(args,
+		"-hls_time", fmt.Sprint(segmentSeconds),
+		"-hls_playlist_type", "vod",
+		"-hls_flags", "independent_segments",
+		"-hls_segment_filename", filepath.Join(outDir, "%v", "segment_%03d.ts"),
+		"-master_pl_name", hlsMasterPlaylist,
+		"-var_stream_map", strings.Join(streamMap, " "),
+	)
+	return filepath.Join(outDir, "%v", hlsVariantPlaylist), media.TranscodeOptions{
+		Format: "hls",
+		Filter: scaleFilter(renditions, info),
+		Args:   args,
+	}
+}
@@ -0,0 +1,91 @@
+package captions
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var ErrInvalidCaptions = errors.New("not an SRT or WebVTT file")
+
+var (
+	timingPattern = regexp.MustCompile(`^\s*(\d+):(\d{2}):(\d{2})[,.](\d{1,3})\s*-->\s*(\d+):(\d{2}):(\d{2})[,.](\d{1,3})`)
+	vttTiming     = regexp.MustCompile(`(?m)^\s*(\d+:)?\d{2}:\d{2}\.\d{3}\s+-->\s+(\d+:)?\d{2}:\d{2}\.\d{3}`)
+	indexPattern  = regexp.MustCompile(`^\d+$`)
+	blankLines    = regexp.MustCompile(`\n\s*\n`)
+	// WebVTT has no <font> tag, which SRT files often use for colour.
+	fontTag = regexp.MustCompile(`(?i)</?font[^>]*>`)
+)
+
+// ToWebVTT converts an SRT or WebVTT caption file to WebVTT with Unix line
+// endings. WebVTT files are passed through once checked to have cues.
+func ToWebVTT(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("%w: captions must be UTF-8", ErrInvalidCaptions)
+	}
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	if isWebVTT(text) {
+		if !vttTiming.MatchString(text) {
+			return nil, fmt.Errorf("%w: no cues found", ErrInvalidCaptions)
+		}
+		return []byte(strings.TrimRight(text, "\n") + "\n"), nil
+	}
+	return srtToWebVTT(text)
+}
+
+func isWebVTT(text string) bool {
+	header, _, _ := strings.Cut(text, "\n")
+	return header == "WEBVTT" || strings.HasPrefix(header, "WEBVTT ") || strings.HasPrefix(header, "WEBVTT\t")
+}
+
+// srtToWebVTT converts SRT cues, separated by blank lines, to WebVTT cues.
+// Blocks without a timing line are dropped.
+func srtToWebVTT(text string) ([]byte, error) {
+	out := strings.Builder{}
+	out.WriteString("WEBVTT\n")
+	cues := 0
+
+	for _, block := range blankLines.Split(strings.TrimSpace(text), -1) {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+		if len(lines) > 0 && indexPattern.MatchString(strings.TrimSpace(lines[0])) {
+			lines = lines[1:]
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		timing := timingPattern.FindStringSubmatch(lines[0])
+		if timing == nil {
+			continue
+		}
+
+		fmt.Fprintf(&out, "\n%s --> %s\n", timestamp(timing[1:5]), timestamp(timing[5:9]))
+		for _, line := range lines[1:] {
+			line = fontTag.ReplaceAllString(line, "")
+			// "-->" would start a new cue.
+			out.WriteString(strings.ReplaceAll(line, "-->", "->") + "\n")
+		}
+		cues++
+	}
+
+	if cues == 0 {
+		return nil, fmt.Errorf("%w: no cues found", ErrInvalidCaptions)
+	}
+	return []byte(out.String()), nil
+}
+
+// timestamp formats hours, minutes, seconds and milliseconds as WebVTT's
+// HH:MM:SS.mmm.
+func timestamp(parts []string) string {
+	ms := parts[3] + strings.Repeat("0", 3-len(parts[3]))
+	hours := parts[0]
+	if len(hours) < 2 {
+		hours = "0" + hours
+	}
+	return fmt.Sprintf("%s:%s:%s.%s", hours, parts[1], parts[2], ms)
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Blob is a stored object identified by the SHA-256 hash of its content.
+// Identical content is stored once, under the key it was first stored at,
+// and RefCount counts the references to it.
+type Blob struct {
+	Bucket    string
+	Hash      string
+	Key       string
+	Size      int64
+	RefCount  int
+	CreatedAt time.Time
+}
+
+// ReferenceBlob takes a reference to the blob with hash in bucket, returning
+// it, or nil if there is no such blob.
+func (c Client) ReferenceBlob(bucket, hash string) (*Blob, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	blob, err := referenceBlob(tx, bucket, hash)
+	if err != nil || blob == nil {
+		return nil, err
+	}
+	return blob, tx.Commit()
+}
+
+// ReferenceBlobByKey takes another reference to the blob stored at key in
+// bucket, reporting whether there is one.
+func (c Client) ReferenceBlobByKey(bucket, key string) (bool, error) {
+	result, err := c.db.Exec(`
+	UPDATE blobs SET ref_count = ref_count + 1
+	WHERE bucket = ? AND key = ?
+	`, bucket, key)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// AcquireBlob takes a reference to the blob with hash in bucket, recording
+// one stored at key if there is none yet. The returned blob's key differs
+// from key when identical content was recorded first.
+func (c Client) AcquireBlob(bucket, hash, key string, size int64) (Blob, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return Blob{}, err
+	}
+	defer tx.Rollback()
+
+	blob, err := referenceBlob(tx, bucket, hash)
+	if err != nil {
+		return Blob{}, err
+	}
+	if blob == nil {
+		blob = &Blob{
+			Bucket:    bucket,
+			Hash:      hash,
+			Key:       key,
+			Size:      size,
+			RefCount:  1,
+			CreatedAt: time.Now().UTC(),
+		}
+		query := `
+		INSERT INTO blobs (
+			bucket,
+			hash,
+			key,
+			size,
+			ref_count,
+			created_at
+		) VALUES (?, ?, ?, ?, ?, ?)
+		`
+		_, err = tx.Exec(query, blob.Bucket, blob.Hash, blob.Key, blob.Size, blob.RefCount, blob.CreatedAt)
+		if err != nil {
+			return Blob{}, err
+		}
+	}
+	return *blob, tx.Commit()
+}
+
+// ReleaseBlob drops a reference to the blob stored at key in bucket. It
+// reports whether that was the last reference, in which case the blob is
+// forgotten and its object can be deleted. Keys no blob is stored at are
+// left alone, as what else refers to them isn't known.
+func (c Client) ReleaseBlob(bucket, key string) (bool, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var refCount int
+	err = tx.QueryRow(`
+	UPDATE blobs SET ref_count = ref_count - 1
+	WHERE bucket = ? AND key = ?
+	RETURNING ref_count
+	`, bucket, key).Scan(&refCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if refCount <= 0 {
+		_, err = tx.Exec("DELETE FROM blobs WHERE bucket = ? AND key = ?", bucket, key)
+		if err != nil {
+			return false, err
+		}
+	}
+	return refCount <= 0, tx.Commit()
+}
+
+func referenceBlob(tx *sql.Tx, bucket, hash string) (*Blob, error) {
+	blob := Blob{}
+	err := tx.QueryRow(`
+	UPDATE blobs SET ref_count = ref_count + 1
+	WHERE bucket = ? AND hash = ?
+	RETURNING bucket, hash, key, size, ref_count, created_at
+	`, bucket, hash).Scan(&blob.Bucket, &blob.Hash, &blob.Key, &blob.Size, &blob.RefCount, &blob.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &blob, nil
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type CaptionSource string
+
+const (
+	CaptionSourceUpload   CaptionSource = "upload"
+	CaptionSourceEmbedded CaptionSource = "embedded"
+)
+
+// Caption is a WebVTT text track for one language of a video. URL holds a
+// storage reference until the video is returned to a client.
+type Caption struct {
+	VideoID   uuid.UUID     `json:"-"`
+	Language  string        `json:"language"`
+	Label     string        `json:"label"`
+	Kind      string        `json:"kind"`
+	URL       string        `json:"url"`
+	Source    CaptionSource `json:"source"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// SetCaption adds a caption track to a video, replacing any it already has
+// in the same language. It returns the replaced caption, if there was one,
+// and sql.ErrNoRows if there is no such video.
+func (c Client) SetCaption(caption Caption) (*Caption, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Touching the video first fails for videos that have been deleted.
+	result, err := tx.Exec("UPDATE videos SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", caption.VideoID)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if updated == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	var replaced *Caption
+	existing, err := c.getCaptionsTx(tx, "video_id = ? AND language = ?", caption.VideoID, caption.Language)
+	if err != nil {
+		return nil, err
+	}
+	if previous := existing[caption.VideoID]; len(previous) > 0 {
+		replaced = &previous[0]
+	}
+
+	query := `
+	INSERT INTO captions (
+		video_id,
+		language,
+		label,
+		kind,
+		url,
+		source,
+		created_at
+	) VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT (video_id, language) DO UPDATE SET
+		label = excluded.label,
+		kind = excluded.kind,
+		url = excluded.url,
+		source = excluded.source,
+		created_at = excluded.created_at
+	`
+	_, err = tx.Exec(query, caption.VideoID, caption.Language, caption.Label, caption.Kind, caption.URL, caption.Source)
+	if err != nil {
+		return nil, err
+	}
+	return replaced, tx.Commit()
+}
+
+// DeleteCaption removes a video's caption track in language, returning it,
+// or nil if there was none.
+func (c Client) DeleteCaption(videoID uuid.UUID, language string) (*Caption, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	existing, err := c.getCaptionsTx(tx, "video_id = ? AND language = ?", videoID, language)
+	if err != nil {
+		return nil, err
+	}
+	previous := existing[videoID]
+	if len(previous) == 0 {
+		return nil, nil
+	}
+
+	_, err = tx.Exec("DELETE FROM captions WHERE video_id = ? AND language = ?", videoID, language)
+	if err != nil {
+		return nil, err
+	}
+	return &previous[0], tx.Commit()
+}
+
+// GetCaptions returns a video's caption tracks, ordered by language.
+func (c Client) GetCaptions(videoID uuid.UUID) ([]Caption, error) {
+	captions, err := c.getCaptions("video_id = ?", videoID)
+	if err != nil {
+		return nil, err
+	}
+	return captions[videoID], nil
+}
+
+// getCaptions loads the caption tracks of every video matched by where,
+// grouped by video.
+func (c Client) getCaptions(where string, args ...any) (map[uuid.UUID][]Caption, error) {
+	return c.getCaptionsTx(c.db, where, args...)
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func (c Client) getCaptionsTx(q querier, where string, args ...any) (map[uuid.UUID][]Caption, error) {
+	query := `
+	SELECT video_id, language, label, kind, url, source, created_at
+	FROM captions
+	WHERE ` + where + `
+	ORDER BY video_id, language
+	`
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	captions := map[uuid.UUID][]Caption{}
+	for rows.Next() {
+		var caption Caption
+		err := rows.Scan(
+			&caption.VideoID,
+			&caption.Language,
+			&caption.Label,
+			&caption.Kind,
+			&caption.URL,
+			&caption.Source,
+			&caption.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		captions[caption.VideoID] = append(captions[caption.VideoID], caption)
+	}
+	return captions, rows.Err()
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -12,7 +13,13 @@ type Client struct {
 }
 
 func NewClient(pathToDB string) (Client, error) {
-	db, err := sql.Open("sqlite3", pathToDB)
+	// Background workers write concurrently with request handlers, so wait
+	// for locks instead of failing immediately with SQLITE_BUSY.
+	separator := "?"
+	if strings.Contains(pathToDB, "?") {
+		separator = "&"
+	}
+	db, err := sql.Open("sqlite3", pathToDB+separator+"_busy_timeout=5000")
 	if err != nil {
 		return Client{}, err
 	}
@@ -72,9 +79,213 @@ func (c *Client) autoMigrate() error {
 	if err != nil {
 		return err
 	}
+
+	multipartUploadTable := `
+	CREATE TABLE IF NOT EXISTS multipart_uploads (
+		video_id TEXT PRIMARY KEY,
+		upload_id TEXT NOT NULL,
+		object_key TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(multipartUploadTable)
+	if err != nil {
+		return err
+	}
+
+	tusUploadTable := `
+	CREATE TABLE IF NOT EXISTS tus_uploads (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		video_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		upload_length INTEGER NOT NULL,
+		upload_offset INTEGER NOT NULL DEFAULT 0,
+		expires_at TIMESTAMP NOT NULL,
+		file_type TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY(video_id) REFERENCES videos(id),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(tusUploadTable)
+	if err != nil {
+		return err
+	}
+
+	thumbnailVariantTable := `
+	CREATE TABLE IF NOT EXISTS thumbnail_variants (
+		video_id TEXT NOT NULL,
+		size TEXT NOT NULL,
+		width INTEGER NOT NULL,
+		height INTEGER NOT NULL,
+		url TEXT NOT NULL,
+		PRIMARY KEY(video_id, size),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(thumbnailVariantTable)
+	if err != nil {
+		return err
+	}
+
+	captionTable := `
+	CREATE TABLE IF NOT EXISTS captions (
+		video_id TEXT NOT NULL,
+		language TEXT NOT NULL,
+		label TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		url TEXT NOT NULL,
+		source TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		PRIMARY KEY(video_id, language),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(captionTable)
+	if err != nil {
+		return err
+	}
+
+	blobTable := `
+	CREATE TABLE IF NOT EXISTS blobs (
+		bucket TEXT NOT NULL,
+		hash TEXT NOT NULL,
+		key TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		ref_count INTEGER NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		PRIMARY KEY(bucket, hash),
+		UNIQUE(bucket, key)
+	);
+	`
+	_, err = c.db.Exec(blobTable)
+	if err != nil {
+		return err
+	}
+
+	jobTable := `
+	CREATE TABLE IF NOT EXISTS jobs (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		video_id TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		max_attempts INTEGER NOT NULL,
+		run_at TIMESTAMP NOT NULL,
+		last_error TEXT,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	CREATE INDEX IF NOT EXISTS jobs_status_run_at ON jobs(status, run_at);
+	`
+	_, err = c.db.Exec(jobTable)
+	if err != nil {
+		return err
+	}
+
+	// Columns added after the videos table was first released.
+	videoColumns := []struct {
+		name       string
+		definition string
+	}{
+		{"status", "TEXT NOT NULL DEFAULT 'draft'"},
+		{"status_error", "TEXT"},
+		{"uploading_at", "TIMESTAMP"},
+		{"processing_at", "TIMESTAMP"},
+		{"ready_at", "TIMESTAMP"},
+		{"failed_at", "TIMESTAMP"},
+		{"hls_playlist_url", "TEXT"},
+		{"dash_manifest_url", "TEXT"},
+		{"original_url", "TEXT"},
+		{"duration", "REAL"},
+		{"video_codec", "TEXT"},
+		{"audio_codec", "TEXT"},
+		{"bit_rate", "INTEGER"},
+		{"frame_rate", "REAL"},
+		{"width", "INTEGER"},
+		{"height", "INTEGER"},
+		{"audio_channels", "INTEGER"},
+		{"file_size", "INTEGER"},
+		{"rotation", "INTEGER"},
+		{"preview_url", "TEXT"},
+		{"storyboard_url", "TEXT"},
+		{"storyboard_sprite_url", "TEXT"},
+		{"audio_url", "TEXT"},
+		{"master_url", "TEXT"},
+	}
+	addedStatus := false
+	for _, column := range videoColumns {
+		added, err := c.addColumnIfMissing("videos", column.name, column.definition)
+		if err != nil {
+			return err
+		}
+		if column.name == "status" {
+			addedStatus = added
+		}
+	}
+	for _, column := range []string{"webp_url", "avif_url"} {
+		_, err = c.addColumnIfMissing("thumbnail_variants", column, "TEXT")
+		if err != nil {
+			return err
+		}
+	}
+	_, err = c.addColumnIfMissing("tus_uploads", "file_type", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+
+	// Videos from before statuses were tracked are ready if they have a video
+	// and drafts otherwise. Adding the column made them all drafts, so this
+	// only runs when it was just added.
+	if addedStatus {
+		_, err = c.db.Exec(`
+		UPDATE videos
+		SET status = CASE WHEN video_url IS NULL THEN 'draft' ELSE 'ready' END
+		`)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// addColumnIfMissing adds column to table unless it is already there,
+// reporting whether it was added.
+func (c *Client) addColumnIfMissing(table, column, definition string) (bool, error) {
+	rows, err := c.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, err
+		}
+		if name == column {
+			return false, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	rows.Close()
+
+	_, err = c.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err == nil, err
+}
+
 func (c Client) Reset() error {
 	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
 		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
@@ -82,6 +293,24 @@ func (c Client) Reset() error {
 	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
 		return fmt.Errorf("failed to reset table users: %w", err)
 	}
+	if _, err := c.db.Exec("DELETE FROM jobs"); err != nil {
+		return fmt.Errorf("failed to reset table jobs: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM tus_uploads"); err != nil {
+		return fmt.Errorf("failed to reset table tus_uploads: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM multipart_uploads"); err != nil {
+		return fmt.Errorf("failed to reset table multipart_uploads: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM thumbnail_variants"); err != nil {
+		return fmt.Errorf("failed to reset table thumbnail_variants: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM captions"); err != nil {
+		return fmt.Errorf("failed to reset table captions: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM blobs"); err != nil {
+		return fmt.Errorf("failed to reset table blobs: %w", err)
+	}
 	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
 		return fmt.Errorf("failed to reset table videos: %w", err)
 	}
@@ -0,0 +1,227 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type JobStatus string
+
+const (
+	JobStatusQueued    JobStatus = "queued"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusSucceeded JobStatus = "succeeded"
+	JobStatusFailed    JobStatus = "failed"
+)
+
+// Job is a unit of background work, such as processing an uploaded video.
+type Job struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Status    JobStatus `json:"status"`
+	Attempts  int       `json:"attempts"`
+	RunAt     time.Time `json:"run_at"`
+	LastError *string   `json:"last_error"`
+	CreateJobParams
+}
+
+type CreateJobParams struct {
+	VideoID     uuid.UUID `json:"video_id"`
+	Kind        string    `json:"kind"`
+	Payload     string    `json:"payload"`
+	MaxAttempts int       `json:"max_attempts"`
+}
+
+func (c Client) CreateJob(params CreateJobParams) (Job, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO jobs (
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		kind,
+		payload,
+		status,
+		attempts,
+		max_attempts,
+		run_at
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, 0, ?, ?)
+	`
+	_, err := c.db.Exec(
+		query,
+		id,
+		params.VideoID,
+		params.Kind,
+		params.Payload,
+		JobStatusQueued,
+		params.MaxAttempts,
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return Job{}, err
+	}
+	return c.GetJob(id)
+}
+
+func (c Client) GetJob(id uuid.UUID) (Job, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		kind,
+		payload,
+		status,
+		attempts,
+		max_attempts,
+		run_at,
+		last_error
+	FROM jobs
+	WHERE id = ?
+	`
+	var job Job
+	err := c.db.QueryRow(query, id).Scan(
+		&job.ID,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.VideoID,
+		&job.Kind,
+		&job.Payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LastError,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Job{}, nil
+		}
+		return Job{}, err
+	}
+	return job, nil
+}
+
+// GetQueuedVideoJobs returns a video's jobs that are waiting to run.
+func (c Client) GetQueuedVideoJobs(videoID uuid.UUID) ([]Job, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		kind,
+		payload,
+		status,
+		attempts,
+		max_attempts,
+		run_at,
+		last_error
+	FROM jobs
+	WHERE video_id = ? AND status = ?
+	`
+	rows, err := c.db.Query(query, videoID, JobStatusQueued)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		var job Job
+		if err := rows.Scan(
+			&job.ID,
+			&job.CreatedAt,
+			&job.UpdatedAt,
+			&job.VideoID,
+			&job.Kind,
+			&job.Payload,
+			&job.Status,
+			&job.Attempts,
+			&job.MaxAttempts,
+			&job.RunAt,
+			&job.LastError,
+		); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// ClaimJob atomically marks the oldest due job as running and returns it.
+// It returns a zero Job when nothing is due.
+func (c Client) ClaimJob(now time.Time) (Job, error) {
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		attempts = attempts + 1,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = (
+		SELECT id FROM jobs
+		WHERE status = ? AND run_at <= ?
+		ORDER BY run_at
+		LIMIT 1
+	)
+	RETURNING id
+	`
+	var id uuid.UUID
+	err := c.db.QueryRow(query, JobStatusRunning, JobStatusQueued, now.UTC()).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Job{}, nil
+		}
+		return Job{}, err
+	}
+	return c.GetJob(id)
+}
+
+func (c Client) CompleteJob(id uuid.UUID) error {
+	query := `
+	UPDATE jobs
+	SET status = ?, last_error = NULL, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, JobStatusSucceeded, id)
+	return err
+}
+
+// RetryJob records a failed attempt and queues the job to run again at runAt.
+func (c Client) RetryJob(id uuid.UUID, lastError string, runAt time.Time) error {
+	query := `
+	UPDATE jobs
+	SET status = ?, last_error = ?, run_at = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, JobStatusQueued, lastError, runAt.UTC(), id)
+	return err
+}
+
+func (c Client) FailJob(id uuid.UUID, lastError string) error {
+	query := `
+	UPDATE jobs
+	SET status = ?, last_error = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, JobStatusFailed, lastError, id)
+	return err
+}
+
+// RequeueRunningJobs puts jobs that were running when the server stopped back
+// on the queue.
+func (c Client) RequeueRunningJobs() error {
+	query := `
+	UPDATE jobs
+	SET status = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE status = ?
+	`
+	_, err := c.db.Exec(query, JobStatusQueued, JobStatusRunning)
+	return err
+}
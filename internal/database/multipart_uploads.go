@@ -0,0 +1,64 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MultipartUpload tracks the in-progress resumable upload for a video.
+type MultipartUpload struct {
+	VideoID   uuid.UUID `json:"video_id"`
+	UploadID  string    `json:"upload_id"`
+	ObjectKey string    `json:"object_key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (c Client) CreateMultipartUpload(upload MultipartUpload) (MultipartUpload, error) {
+	query := `
+	INSERT INTO multipart_uploads (
+		video_id,
+		upload_id,
+		object_key,
+		created_at
+	) VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	`
+	_, err := c.db.Exec(query, upload.VideoID, upload.UploadID, upload.ObjectKey)
+	if err != nil {
+		return MultipartUpload{}, err
+	}
+	return c.GetMultipartUpload(upload.VideoID)
+}
+
+func (c Client) GetMultipartUpload(videoID uuid.UUID) (MultipartUpload, error) {
+	query := `
+	SELECT video_id, upload_id, object_key, created_at
+	FROM multipart_uploads
+	WHERE video_id = ?
+	`
+	var upload MultipartUpload
+	err := c.db.QueryRow(query, videoID).Scan(
+		&upload.VideoID,
+		&upload.UploadID,
+		&upload.ObjectKey,
+		&upload.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return MultipartUpload{}, nil
+		}
+		return MultipartUpload{}, err
+	}
+	return upload, nil
+}
+
+func (c Client) DeleteMultipartUpload(videoID uuid.UUID) error {
+	query := `
+	DELETE FROM multipart_uploads
+	WHERE video_id = ?
+	`
+	_, err := c.db.Exec(query, videoID)
+	return err
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ThumbnailVariant is one resized copy of a video's thumbnail. URL holds a
+// storage reference until the video is returned to a client.
+type ThumbnailVariant struct {
+	VideoID uuid.UUID `json:"-"`
+	Size    string    `json:"size"`
+	Width   int       `json:"width"`
+	Height  int       `json:"height"`
+	URL     string    `json:"url"`
+	WebPURL *string   `json:"webp_url"`
+	AVIFURL *string   `json:"avif_url"`
+}
+
+// SetThumbnailVariants replaces all of a video's thumbnail variants and
+// points its thumbnail_url at the last, largest, one, returning the variants
+// it replaced. It returns sql.ErrNoRows if there is no such video.
+func (c Client) SetThumbnailVariants(videoID uuid.UUID, variants []ThumbnailVariant) ([]ThumbnailVariant, error) {
+	replaced, _, err := c.setThumbnailVariants(videoID, variants, false)
+	return replaced, err
+}
+
+// SetDefaultThumbnailVariants is SetThumbnailVariants for videos that don't
+// have a thumbnail yet. It reports whether variants were saved.
+func (c Client) SetDefaultThumbnailVariants(videoID uuid.UUID, variants []ThumbnailVariant) (bool, error) {
+	_, saved, err := c.setThumbnailVariants(videoID, variants, true)
+	return saved, err
+}
+
+func (c Client) setThumbnailVariants(videoID uuid.UUID, variants []ThumbnailVariant, onlyIfUnset bool) ([]ThumbnailVariant, bool, error) {
+	if len(variants) == 0 {
+		return nil, false, errors.New("no thumbnail variants")
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE videos
+	SET
+		thumbnail_url = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	if onlyIfUnset {
+		query += "AND thumbnail_url IS NULL\n"
+	}
+	result, err := tx.Exec(query, variants[len(variants)-1].URL, videoID)
+	if err != nil {
+		return nil, false, err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return nil, false, err
+	}
+	if updated == 0 {
+		if onlyIfUnset {
+			return nil, false, nil
+		}
+		return nil, false, sql.ErrNoRows
+	}
+
+	existing, err := c.getThumbnailVariantsTx(tx, "video_id = ?", videoID)
+	if err != nil {
+		return nil, false, err
+	}
+	_, err = tx.Exec("DELETE FROM thumbnail_variants WHERE video_id = ?", videoID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	query = `
+	INSERT INTO thumbnail_variants (
+		video_id,
+		size,
+		width,
+		height,
+		url,
+		webp_url,
+		avif_url
+	) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	for _, variant := range variants {
+		_, err = tx.Exec(query, videoID, variant.Size, variant.Width, variant.Height, variant.URL, variant.WebPURL, variant.AVIFURL)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return existing[videoID], true, tx.Commit()
+}
+
+// getThumbnailVariants loads the thumbnail variants of every video matched by
+// where, smallest first, grouped by video.
+func (c Client) getThumbnailVariants(where string, args ...any) (map[uuid.UUID][]ThumbnailVariant, error) {
+	return c.getThumbnailVariantsTx(c.db, where, args...)
+}
+
+func (c Client) getThumbnailVariantsTx(q querier, where string, args ...any) (map[uuid.UUID][]ThumbnailVariant, error) {
+	query := `
+	SELECT video_id, size, width, height, url, webp_url, avif_url
+	FROM thumbnail_variants
+	WHERE ` + where + `
+	ORDER BY video_id, width
+	`
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := map[uuid.UUID][]ThumbnailVariant{}
+	for rows.Next() {
+		var variant ThumbnailVariant
+		err := rows.Scan(
+			&variant.VideoID,
+			&variant.Size,
+			&variant.Width,
+			&variant.Height,
+			&variant.URL,
+			&variant.WebPURL,
+			&variant.AVIFURL,
+		)
+		if err != nil {
+			return nil, err
+		}
+		variants[variant.VideoID] = append(variants[variant.VideoID], variant)
+	}
+	return variants, rows.Err()
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TusUpload is a resumable upload created through the tus protocol.
+type TusUpload struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	VideoID   uuid.UUID `json:"video_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Length    int64     `json:"length"`
+	Offset    int64     `json:"offset"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// FileType is the media type declared in the upload's metadata, if any.
+	FileType string `json:"file_type"`
+}
+
+type CreateTusUploadParams struct {
+	VideoID   uuid.UUID
+	UserID    uuid.UUID
+	Length    int64
+	ExpiresAt time.Time
+	FileType  string
+}
+
+func (c Client) CreateTusUpload(params CreateTusUploadParams) (TusUpload, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO tus_uploads (
+		id,
+		created_at,
+		video_id,
+		user_id,
+		upload_length,
+		upload_offset,
+		expires_at,
+		file_type
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, 0, ?, ?)
+	`
+	_, err := c.db.Exec(query, id, params.VideoID, params.UserID, params.Length, params.ExpiresAt, params.FileType)
+	if err != nil {
+		return TusUpload{}, err
+	}
+	return c.GetTusUpload(id)
+}
+
+func (c Client) GetTusUpload(id uuid.UUID) (TusUpload, error) {
+	query := `
+	SELECT id, created_at, video_id, user_id, upload_length, upload_offset, expires_at, file_type
+	FROM tus_uploads
+	WHERE id = ?
+	`
+	var upload TusUpload
+	err := c.db.QueryRow(query, id).Scan(
+		&upload.ID,
+		&upload.CreatedAt,
+		&upload.VideoID,
+		&upload.UserID,
+		&upload.Length,
+		&upload.Offset,
+		&upload.ExpiresAt,
+		&upload.FileType,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return TusUpload{}, nil
+		}
+		return TusUpload{}, err
+	}
+	return upload, nil
+}
+
+func (c Client) UpdateTusUploadOffset(id uuid.UUID, offset int64) error {
+	query := `
+	UPDATE tus_uploads
+	SET upload_offset = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, offset, id)
+	return err
+}
+
+func (c Client) GetExpiredTusUploads(now time.Time) ([]TusUpload, error) {
+	return c.getTusUploads("expires_at < ?", now)
+}
+
+// GetVideoTusUploads returns the uploads in progress for a video.
+func (c Client) GetVideoTusUploads(videoID uuid.UUID) ([]TusUpload, error) {
+	return c.getTusUploads("video_id = ?", videoID)
+}
+
+func (c Client) getTusUploads(where string, args ...any) ([]TusUpload, error) {
+	query := `
+	SELECT id, created_at, video_id, user_id, upload_length, upload_offset, expires_at, file_type
+	FROM tus_uploads
+	WHERE ` + where + `
+	`
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []TusUpload{}
+	for rows.Next() {
+		var upload TusUpload
+		if err := rows.Scan(
+			&upload.ID,
+			&upload.CreatedAt,
+			&upload.VideoID,
+			&upload.UserID,
+			&upload.Length,
+			&upload.Offset,
+			&upload.ExpiresAt,
+			&upload.FileType,
+		); err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, rows.Err()
+}
+
+func (c Client) DeleteTusUpload(id uuid.UUID) error {
+	query := `
+	DELETE FROM tus_uploads
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, id)
+	return err
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"github.com/google/uuid"
+)
+
+// VideoMetadata describes a processed video. Width and Height are as
+// displayed, with Rotation (degrees clockwise) applied. Fields are nil for
+// videos processed before metadata was recorded.
+type VideoMetadata struct {
+	Duration      *float64 `json:"duration"`
+	VideoCodec    *string  `json:"video_codec"`
+	AudioCodec    *string  `json:"audio_codec"`
+	BitRate       *int64   `json:"bit_rate"`
+	FrameRate     *float64 `json:"frame_rate"`
+	Width         *int     `json:"width"`
+	Height        *int     `json:"height"`
+	AudioChannels *int     `json:"audio_channels"`
+	FileSize      *int64   `json:"file_size"`
+	Rotation      *int     `json:"rotation"`
+}
+
+func (c Client) SetVideoMetadata(id uuid.UUID, metadata VideoMetadata) error {
+	query := `
+	UPDATE videos
+	SET
+		duration = ?,
+		video_codec = ?,
+		audio_codec = ?,
+		bit_rate = ?,
+		frame_rate = ?,
+		width = ?,
+		height = ?,
+		audio_channels = ?,
+		file_size = ?,
+		rotation = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(
+		query,
+		metadata.Duration,
+		metadata.VideoCodec,
+		metadata.AudioCodec,
+		metadata.BitRate,
+		metadata.FrameRate,
+		metadata.Width,
+		metadata.Height,
+		metadata.AudioChannels,
+		metadata.FileSize,
+		metadata.Rotation,
+		id,
+	)
+	return err
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type VideoStatus string
+
+const (
+	VideoStatusDraft      VideoStatus = "draft"
+	VideoStatusUploading  VideoStatus = "uploading"
+	VideoStatusProcessing VideoStatus = "processing"
+	VideoStatusReady      VideoStatus = "ready"
+	VideoStatusFailed     VideoStatus = "failed"
+)
+
+// videoTransitions lists the statuses each status may move to. A video moves
+// draft → uploading → processing → ready or failed; ready and failed videos
+// can be uploaded again, and a cancelled upload returns to draft (or ready,
+// if an earlier upload is still attached).
+var videoTransitions = map[VideoStatus][]VideoStatus{
+	VideoStatusDraft:      {VideoStatusUploading},
+	VideoStatusUploading:  {VideoStatusUploading, VideoStatusProcessing, VideoStatusFailed, VideoStatusDraft, VideoStatusReady},
+	VideoStatusProcessing: {VideoStatusReady, VideoStatusFailed},
+	VideoStatusReady:      {VideoStatusUploading},
+	VideoStatusFailed:     {VideoStatusUploading, VideoStatusProcessing},
+}
+
+var ErrInvalidVideoTransition = errors.New("invalid video status transition")
+
+func (s VideoStatus) CanTransitionTo(to VideoStatus) bool {
+	for _, allowed := range videoTransitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// statusTimestampColumn is the column recording when a video last entered
+// each status.
+var statusTimestampColumn = map[VideoStatus]string{
+	VideoStatusUploading:  "uploading_at",
+	VideoStatusProcessing: "processing_at",
+	VideoStatusReady:      "ready_at",
+	VideoStatusFailed:     "failed_at",
+}
+
+// TransitionVideoStatus moves a video to a new status, recording when it
+// happened. statusError is stored for failed videos and cleared otherwise.
+// It returns ErrInvalidVideoTransition if the move isn't allowed from the
+// video's current status, and sql.ErrNoRows if there is no such video.
+func (c Client) TransitionVideoStatus(id uuid.UUID, to VideoStatus, statusError string) error {
+	// The check and the update are one statement, so concurrent transitions
+	// can't both move the video from the status they read.
+	args := []any{to, nil}
+	if to == VideoStatusFailed {
+		args[1] = statusError
+	}
+	var from []string
+	for status := range videoTransitions {
+		if status.CanTransitionTo(to) {
+			from = append(from, "?")
+			args = append(args, status)
+		}
+	}
+	if len(from) == 0 {
+		return fmt.Errorf("%w: to %s", ErrInvalidVideoTransition, to)
+	}
+	args = append(args, id)
+
+	query := `
+	UPDATE videos
+	SET
+		status = ?,
+		status_error = ?,
+		updated_at = CURRENT_TIMESTAMP`
+	if column, ok := statusTimestampColumn[to]; ok {
+		query += fmt.Sprintf(",\n\t\t%s = CURRENT_TIMESTAMP", column)
+	}
+	query += `
+	WHERE status IN (` + strings.Join(from, ", ") + `) AND id = ?
+	`
+	result, err := c.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated > 0 {
+		return nil
+	}
+
+	var current VideoStatus
+	err = c.db.QueryRow("SELECT status FROM videos WHERE id = ?", id).Scan(&current)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s to %s", ErrInvalidVideoTransition, current, to)
+}
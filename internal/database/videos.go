@@ -9,11 +9,28 @@ import (
 )
 
 type Video struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	ID                  uuid.UUID          `json:"id"`
+	CreatedAt           time.Time          `json:"created_at"`
+	UpdatedAt           time.Time          `json:"updated_at"`
+	ThumbnailURL        *string            `json:"thumbnail_url"`
+	VideoURL            *string            `json:"video_url"`
+	OriginalURL         *string            `json:"original_url"`
+	MasterURL           *string            `json:"-"`
+	HLSPlaylistURL      *string            `json:"hls_playlist_url"`
+	DASHManifestURL     *string            `json:"dash_manifest_url"`
+	AudioURL            *string            `json:"audio_url"`
+	PreviewURL          *string            `json:"preview_url"`
+	StoryboardURL       *string            `json:"storyboard_url"`
+	StoryboardSpriteURL *string            `json:"storyboard_sprite_url"`
+	Status              VideoStatus        `json:"status"`
+	StatusError         *string            `json:"status_error"`
+	UploadingAt         *time.Time         `json:"uploading_at"`
+	ProcessingAt        *time.Time         `json:"processing_at"`
+	ReadyAt             *time.Time         `json:"ready_at"`
+	FailedAt            *time.Time         `json:"failed_at"`
+	ThumbnailVariants   []ThumbnailVariant `json:"thumbnail_variants"`
+	Captions            []Caption          `json:"captions"`
+	Metadata            VideoMetadata      `json:"metadata"`
 	CreateVideoParams
 }
 
@@ -23,9 +40,8 @@ type CreateVideoParams struct {
 	UserID      uuid.UUID `json:"user_id"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
-	query := `
-	SELECT
+// videoSelectColumns is the column list scanVideo expects.
+const videoSelectColumns = `
 		id,
 		created_at,
 		updated_at,
@@ -33,7 +49,78 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 		description,
 		thumbnail_url,
 		video_url,
-		user_id
+		original_url,
+		master_url,
+		hls_playlist_url,
+		dash_manifest_url,
+		audio_url,
+		preview_url,
+		storyboard_url,
+		storyboard_sprite_url,
+		status,
+		status_error,
+		uploading_at,
+		processing_at,
+		ready_at,
+		failed_at,
+		duration,
+		video_codec,
+		audio_codec,
+		bit_rate,
+		frame_rate,
+		width,
+		height,
+		audio_channels,
+		file_size,
+		rotation,
+		user_id`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVideo(row scanner) (Video, error) {
+	var video Video
+	err := row.Scan(
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailURL,
+		&video.VideoURL,
+		&video.OriginalURL,
+		&video.MasterURL,
+		&video.HLSPlaylistURL,
+		&video.DASHManifestURL,
+		&video.AudioURL,
+		&video.PreviewURL,
+		&video.StoryboardURL,
+		&video.StoryboardSpriteURL,
+		&video.Status,
+		&video.StatusError,
+		&video.UploadingAt,
+		&video.ProcessingAt,
+		&video.ReadyAt,
+		&video.FailedAt,
+		&video.Metadata.Duration,
+		&video.Metadata.VideoCodec,
+		&video.Metadata.AudioCodec,
+		&video.Metadata.BitRate,
+		&video.Metadata.FrameRate,
+		&video.Metadata.Width,
+		&video.Metadata.Height,
+		&video.Metadata.AudioChannels,
+		&video.Metadata.FileSize,
+		&video.Metadata.Rotation,
+		&video.UserID,
+	)
+	return video, err
+}
+
+func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
+	query := `
+	SELECT` + videoSelectColumns + `
 	FROM videos
 	WHERE user_id = ?
 	ORDER BY created_at DESC
@@ -47,22 +134,26 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 
 	videos := []Video{}
 	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
+		video, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
 	}
 
+	variants, err := c.getThumbnailVariants("video_id IN (SELECT id FROM videos WHERE user_id = ?)", userID)
+	if err != nil {
+		return nil, err
+	}
+	captions, err := c.getCaptions("video_id IN (SELECT id FROM videos WHERE user_id = ?)", userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range videos {
+		videos[i].ThumbnailVariants = append([]ThumbnailVariant{}, variants[videos[i].ID]...)
+		videos[i].Captions = append([]Caption{}, captions[videos[i].ID]...)
+	}
+
 	return videos, nil
 }
 
@@ -75,10 +166,11 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		updated_at,
 		title,
 		description,
+		status,
 		user_id
-	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	_, err := c.db.Exec(query, id, params.Title, params.Description, VideoStatusDraft, params.UserID)
 	if err != nil {
 		return Video{}, err
 	}
@@ -87,30 +179,17 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 }
 
 func (c Client) GetVideo(id uuid.UUID) (Video, error) {
+	return c.getVideo(c.db, id)
+}
+
+func (c Client) getVideo(q querier, id uuid.UUID) (Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT` + videoSelectColumns + `
 	FROM videos
 	WHERE id = ?
 	`
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	video, err := scanVideo(q.QueryRow(query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Video{}, nil
@@ -118,9 +197,23 @@ func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 		return Video{}, err
 	}
 
+	variants, err := c.getThumbnailVariantsTx(q, "video_id = ?", id)
+	if err != nil {
+		return Video{}, err
+	}
+	video.ThumbnailVariants = append([]ThumbnailVariant{}, variants[id]...)
+
+	captions, err := c.getCaptionsTx(q, "video_id = ?", id)
+	if err != nil {
+		return Video{}, err
+	}
+	video.Captions = append([]Caption{}, captions[id]...)
+
 	return video, nil
 }
 
+// UpdateVideo saves a video's metadata. Status changes go through
+// TransitionVideoStatus instead.
 func (c Client) UpdateVideo(video Video) error {
 	query := `
 	UPDATE videos
@@ -129,7 +222,16 @@ func (c Client) UpdateVideo(video Video) error {
 		description = ?,
 		thumbnail_url = ?,
 		video_url = ?,
-		user_id = ?
+		original_url = ?,
+		master_url = ?,
+		hls_playlist_url = ?,
+		dash_manifest_url = ?,
+		audio_url = ?,
+		preview_url = ?,
+		storyboard_url = ?,
+		storyboard_sprite_url = ?,
+		user_id = ?,
+		updated_at = CURRENT_TIMESTAMP
 	WHERE id = ?
 	`
 
@@ -139,17 +241,103 @@ func (c Client) UpdateVideo(video Video) error {
 		video.Description,
 		&video.ThumbnailURL,
 		&video.VideoURL,
+		&video.OriginalURL,
+		&video.MasterURL,
+		&video.HLSPlaylistURL,
+		&video.DASHManifestURL,
+		&video.AudioURL,
+		&video.PreviewURL,
+		&video.StoryboardURL,
+		&video.StoryboardSpriteURL,
 		video.UserID,
 		video.ID,
 	)
 	return err
 }
 
-func (c Client) DeleteVideo(id uuid.UUID) error {
+// SetVideoRenditions records where a video's processed files are stored,
+// leaving the rest of the video as it is. It returns sql.ErrNoRows if there
+// is no such video.
+func (c Client) SetVideoRenditions(video Video) error {
+	query := `
+	UPDATE videos
+	SET
+		video_url = ?,
+		original_url = ?,
+		master_url = ?,
+		hls_playlist_url = ?,
+		dash_manifest_url = ?,
+		audio_url = ?,
+		preview_url = ?,
+		storyboard_url = ?,
+		storyboard_sprite_url = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	result, err := c.db.Exec(
+		query,
+		video.VideoURL,
+		video.OriginalURL,
+		video.MasterURL,
+		video.HLSPlaylistURL,
+		video.DASHManifestURL,
+		video.AudioURL,
+		video.PreviewURL,
+		video.StoryboardURL,
+		video.StoryboardSpriteURL,
+		video.ID,
+	)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteVideo deletes a video along with every row that belongs to it,
+// returning the video as it was when deleted, with its thumbnail variants and
+// captions. The returned video is the zero value if there was none.
+func (c Client) DeleteVideo(id uuid.UUID) (Video, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return Video{}, err
+	}
+	defer tx.Rollback()
+
+	// Writing first takes the database's write lock, so nothing can be
+	// added to the video between reading and deleting it.
+	for _, table := range []string{"jobs", "multipart_uploads", "tus_uploads"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE video_id = ?", id)
+		if err != nil {
+			return Video{}, err
+		}
+	}
+
+	video, err := c.getVideo(tx, id)
+	if err != nil {
+		return Video{}, err
+	}
+
+	for _, table := range []string{"thumbnail_variants", "captions"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE video_id = ?", id)
+		if err != nil {
+			return Video{}, err
+		}
+	}
+
 	query := `
 	DELETE FROM videos
 	WHERE id = ?
 	`
-	_, err := c.db.Exec(query, id)
-	return err
+	_, err = tx.Exec(query, id)
+	if err != nil {
+		return Video{}, err
+	}
+	return video, tx.Commit()
 }
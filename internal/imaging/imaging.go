@@ -0,0 +1,169 @@
+// Package imaging decodes, resizes and re-encodes JPEG and PNG images using
+// only the standard library.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+
+	// MaxDimension bounds the width and height of images Decode accepts, so a
+	// small file can't decompress into an enormous bitmap.
+	MaxDimension = 8192
+
+	jpegQuality = 85
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("image must be a JPEG or PNG")
+	ErrTooLarge          = errors.New("image dimensions are too large")
+)
+
+// Decode validates and decodes a JPEG or PNG image, returning its format.
+func Decode(data []byte) (image.Image, string, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) {
+		return nil, "", ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if format != FormatJPEG && format != FormatPNG {
+		return nil, "", ErrUnsupportedFormat
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, "", errors.New("image is empty")
+	}
+	if config.Width > MaxDimension || config.Height > MaxDimension {
+		return nil, "", ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	return img, format, nil
+}
+
+// Encode writes img in format, which must be FormatJPEG or FormatPNG.
+func Encode(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case FormatJPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	case FormatPNG:
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		return encoder.Encode(w, img)
+	default:
+		return ErrUnsupportedFormat
+	}
+}
+
+// ContentType returns the MIME type of format.
+func ContentType(format string) string {
+	return "image/" + format
+}
+
+// Fit scales img down, preserving its aspect ratio, until it fits within
+// maxWidth by maxHeight. Images that already fit are returned unchanged.
+func Fit(img image.Image, maxWidth, maxHeight int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxWidth && height <= maxHeight {
+		return img
+	}
+
+	scale := min(float64(maxWidth)/float64(width), float64(maxHeight)/float64(height))
+	dstWidth := max(1, int(float64(width)*scale+0.5))
+	dstHeight := max(1, int(float64(height)*scale+0.5))
+	return resize(img, dstWidth, dstHeight)
+}
+
+// resize downsamples img to width by height with a box filter: each
+// destination pixel is the area-weighted average of the source pixels it
+// covers. Averaging happens on premultiplied alpha so transparent pixels
+// don't bleed their colour into their neighbours.
+func resize(img image.Image, width, height int) *image.RGBA {
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	xWeights := boxWeights(srcWidth, width)
+	yWeights := boxWeights(srcHeight, height)
+
+	// Resize horizontally into a float buffer, then vertically into dst.
+	rows := make([]float32, srcHeight*width*4)
+	for y := 0; y < srcHeight; y++ {
+		srcRow := src.Pix[y*src.Stride:]
+		for x, taps := range xWeights {
+			var acc [4]float32
+			for _, tap := range taps {
+				p := srcRow[tap.index*4:]
+				for c := 0; c < 4; c++ {
+					acc[c] += float32(p[c]) * tap.weight
+				}
+			}
+			copy(rows[(y*width+x)*4:], acc[:])
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, taps := range yWeights {
+		dstRow := dst.Pix[y*dst.Stride:]
+		for x := 0; x < width; x++ {
+			var acc [4]float32
+			for _, tap := range taps {
+				p := rows[(tap.index*width+x)*4:]
+				for c := 0; c < 4; c++ {
+					acc[c] += p[c] * tap.weight
+				}
+			}
+			for c := 0; c < 4; c++ {
+				dstRow[x*4+c] = clampUint8(acc[c])
+			}
+		}
+	}
+	return dst
+}
+
+type tap struct {
+	index  int
+	weight float32
+}
+
+// boxWeights returns, for each of the dstSize output pixels, the source
+// pixels it covers and how much of each, normalised to sum to 1.
+func boxWeights(srcSize, dstSize int) [][]tap {
+	scale := float64(srcSize) / float64(dstSize)
+	weights := make([][]tap, dstSize)
+	for i := range weights {
+		left := float64(i) * scale
+		right := left + scale
+		for j := int(left); j < srcSize && float64(j) < right; j++ {
+			coverage := min(right, float64(j+1)) - max(left, float64(j))
+			if coverage > 0 {
+				weights[i] = append(weights[i], tap{index: j, weight: float32(coverage / scale)})
+			}
+		}
+	}
+	return weights
+}
+
+func clampUint8(v float32) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
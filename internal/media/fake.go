@@ -0,0 +1,164 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FakeInfo is what Fake reports for every file unless told otherwise: a
+// 1080p H.264 MP4 with AAC audio.
+var FakeInfo = Info{
+	Formats:       []string{"mov", "mp4", "m4a", "3gp", "3g2", "mj2", "matroska", "webm"},
+	Width:         1920,
+	Height:        1080,
+	VideoCodec:    "h264",
+	PixelFormat:   "yuv420p",
+	FrameRate:     30,
+	HasAudio:      true,
+	AudioCodec:    "aac",
+	AudioChannels: 2,
+	Duration:      10,
+	BitRate:       5_000_000,
+}
+
+// Fake is a Tool that doesn't need ffmpeg. It is meant for tests and local
+// development: conversions copy the source file unchanged and extracted
+// frames are a plain grey image.
+type Fake struct {
+	// Info is returned by Probe, FakeInfo if it is the zero value.
+	Info Info
+	// Err, if set, is returned by every method.
+	Err error
+	// EncoderNames is returned by Encoders.
+	EncoderNames []string
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+// Calls lists the methods called so far and the file each was called on, as
+// "Method path".
+func (f *Fake) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.calls...)
+}
+
+func (f *Fake) record(method, path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, method+" "+path)
+	return f.Err
+}
+
+func (f *Fake) Probe(ctx context.Context, path string) (Info, error) {
+	if err := f.record("Probe", path); err != nil {
+		return Info{}, err
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return Info{}, err
+	}
+
+	info := f.Info
+	if info.Width == 0 {
+		info = FakeInfo
+	}
+	info.Formats = append([]string{}, info.Formats...)
+	info.Size = stat.Size()
+	return info, nil
+}
+
+func (f *Fake) Remux(ctx context.Context, src, dst string, opts RemuxOptions) error {
+	if err := f.record("Remux", src); err != nil {
+		return err
+	}
+	return copyFile(src, dst)
+}
+
+func (f *Fake) Transcode(ctx context.Context, src, dst string, opts TranscodeOptions) error {
+	if err := f.record("Transcode", src); err != nil {
+		return err
+	}
+	return copyFile(src, dst)
+}
+
+func (f *Fake) ExtractFrame(ctx context.Context, src, dst string, opts FrameOptions) error {
+	if err := f.record("ExtractFrame", src); err != nil {
+		return err
+	}
+	info, err := f.Probe(ctx, src)
+	if err != nil {
+		return err
+	}
+	if opts.At.Seconds() >= info.Duration {
+		return ErrNoFrame
+	}
+
+	img := image.NewGray(image.Rect(0, 0, info.Width, info.Height))
+	for i := range img.Pix {
+		img.Pix[i] = 128
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return jpeg.Encode(out, img, nil)
+}
+
+// Keyframes reports a keyframe every two seconds.
+func (f *Fake) Keyframes(ctx context.Context, path string) ([]time.Duration, error) {
+	if err := f.record("Keyframes", path); err != nil {
+		return nil, err
+	}
+	info, err := f.Probe(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	keyframes := []time.Duration{}
+	for at := time.Duration(0); at.Seconds() < info.Duration; at += 2 * time.Second {
+		keyframes = append(keyframes, at)
+	}
+	return keyframes, nil
+}
+
+func (f *Fake) Encoders(ctx context.Context) ([]string, error) {
+	if err := f.record("Encoders", ""); err != nil {
+		return nil, err
+	}
+	return append([]string{}, f.EncoderNames...), nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("couldn't copy %s: %w", src, err)
+	}
+	return out.Close()
+}
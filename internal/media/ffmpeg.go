@@ -0,0 +1,322 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FFmpeg runs the ffmpeg and ffprobe binaries. Every command is killed when
+// its context is done or, if Timeout is set, after Timeout.
+type FFmpeg struct {
+	FFmpegPath  string
+	FFprobePath string
+	Timeout     time.Duration
+}
+
+// NewFFmpeg returns an FFmpeg that runs the binaries at the given paths,
+// looking them up on PATH if they are empty.
+func NewFFmpeg(ffmpegPath, ffprobePath string, timeout time.Duration) *FFmpeg {
+	if ffmpegPath == "" {
+		ffmpegPath = "ffmpeg"
+	}
+	if ffprobePath == "" {
+		ffprobePath = "ffprobe"
+	}
+	return &FFmpeg{
+		FFmpegPath:  ffmpegPath,
+		FFprobePath: ffprobePath,
+		Timeout:     timeout,
+	}
+}
+
+func (f *FFmpeg) Probe(ctx context.Context, path string) (Info, error) {
+	var out bytes.Buffer
+	err := f.run(ctx, &out, f.FFprobePath, "-v", "error", "-print_format", "json", "-show_format", "-show_streams", path)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return Info{}, fmt.Errorf("%w: %w", ErrUnreadable, err)
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return parseProbe(out.Bytes())
+}
+
+func (f *FFmpeg) Remux(ctx context.Context, src, dst string, opts RemuxOptions) error {
+	args := append([]string{"-y"}, seekArgs(src, opts.Start)...)
+	args = append(args, durationArgs(opts.Start, opts.End)...)
+	args = append(args, "-map", fmt.Sprintf("0:%d", opts.VideoStream), "-map", "0:a:0?", "-c", "copy")
+	if opts.Start > 0 {
+		args = append(args, "-avoid_negative_ts", "make_zero")
+	}
+	if opts.FastStart {
+		args = append(args, "-movflags", "+faststart")
+	}
+	if opts.Format != "" {
+		args = append(args, "-f", opts.Format)
+	}
+	return f.ffmpeg(ctx, append(args, dst)...)
+}
+
+func (f *FFmpeg) Transcode(ctx context.Context, src, dst string, opts TranscodeOptions) error {
+	args := append([]string{"-y"}, seekArgs(src, opts.Start)...)
+	for _, input := range opts.Inputs {
+		args = append(args, "-i", input)
+	}
+	args = append(args, durationArgs(opts.Start, opts.End)...)
+	if opts.Filter != "" {
+		args = append(args, "-filter_complex", opts.Filter)
+	}
+	if opts.VideoCodec != "" {
+		args = append(args, "-c:v", opts.VideoCodec)
+	}
+	if opts.AudioCodec != "" {
+		args = append(args, "-c:a", opts.AudioCodec)
+	}
+	args = append(args, opts.Args...)
+	if opts.Format != "" {
+		args = append(args, "-f", opts.Format)
+	}
+	return f.ffmpeg(ctx, append(args, dst)...)
+}
+
+// seekArgs opens src as the first input, seeking to start if it is set.
+// Seeking on the input lands stream copies on the keyframe at or before
+// start, and decodes and drops the frames up to start otherwise.
+func seekArgs(src string, start time.Duration) []string {
+	if start > 0 {
+		return []string{"-ss", formatSeconds(start), "-i", src}
+	}
+	return []string{"-i", src}
+}
+
+// durationArgs stop the output at end, if it is set. They must follow every
+// input, or they would apply to the next one.
+func durationArgs(start, end time.Duration) []string {
+	if end > start {
+		return []string{"-t", formatSeconds(end - start)}
+	}
+	return nil
+}
+
+func formatSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// ExtractFrame checks that ffmpeg actually wrote a frame: it succeeds
+// without writing anything when nothing matches.
+func (f *FFmpeg) ExtractFrame(ctx context.Context, src, dst string, opts FrameOptions) error {
+	args := []string{"-y"}
+	if opts.SceneThreshold > 0 {
+		args = append(args, "-i", src, "-vf", fmt.Sprintf("select='gt(scene,%g)'", opts.SceneThreshold))
+	} else {
+		args = append(args, "-ss", formatSeconds(opts.At), "-i", src)
+	}
+	args = append(args, "-frames:v", "1", "-q:v", "2", "-update", "1", dst)
+
+	if err := f.ffmpeg(ctx, args...); err != nil {
+		return err
+	}
+	info, err := os.Stat(dst)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNoFrame
+	}
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return ErrNoFrame
+	}
+	return nil
+}
+
+func (f *FFmpeg) Keyframes(ctx context.Context, path string) ([]time.Duration, error) {
+	var out bytes.Buffer
+	err := f.run(ctx, &out, f.FFprobePath, "-v", "error", "-select_streams", "v:0", "-show_entries", "packet=pts_time,flags", "-of", "csv=print_section=0", path)
+	if err != nil {
+		return nil, err
+	}
+
+	keyframes := []time.Duration{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		pts, flags, ok := strings.Cut(strings.TrimSpace(line), ",")
+		if !ok || !strings.HasPrefix(flags, "K") {
+			continue
+		}
+		seconds, err := strconv.ParseFloat(pts, 64)
+		if err != nil {
+			continue
+		}
+		keyframes = append(keyframes, time.Duration(seconds*float64(time.Second)))
+	}
+	return keyframes, nil
+}
+
+func (f *FFmpeg) Encoders(ctx context.Context) ([]string, error) {
+	var out bytes.Buffer
+	if err := f.run(ctx, &out, f.FFmpegPath, "-hide_banner", "-encoders"); err != nil {
+		return nil, err
+	}
+
+	// Encoders are listed one per line after a legend, as capability flags
+	// followed by the encoder's name.
+	_, list, _ := strings.Cut(out.String(), "------")
+	encoders := []string{}
+	for _, line := range strings.Split(list, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 {
+			encoders = append(encoders, fields[1])
+		}
+	}
+	return encoders, nil
+}
+
+func (f *FFmpeg) ffmpeg(ctx context.Context, args ...string) error {
+	return f.run(ctx, nil, f.FFmpegPath, append([]string{"-hide_banner", "-loglevel", "error"}, args...)...)
+}
+
+// run runs the command, writing its output to stdout if it isn't nil.
+func (f *FFmpeg) run(ctx context.Context, stdout io.Writer, command string, args ...string) error {
+	if f.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Stdout = stdout
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// A killed command exits with a signal; report why it was killed.
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return &CommandError{Command: command, Err: err, Stderr: stderrTail(stderr.String())}
+	}
+	return nil
+}
+
+type ffprobeOutput struct {
+	Streams []struct {
+		Index        int               `json:"index"`
+		CodecType    string            `json:"codec_type"`
+		CodecName    string            `json:"codec_name"`
+		PixFmt       string            `json:"pix_fmt"`
+		Width        int               `json:"width"`
+		Height       int               `json:"height"`
+		AvgFrameRate string            `json:"avg_frame_rate"`
+		RFrameRate   string            `json:"r_frame_rate"`
+		Channels     int               `json:"channels"`
+		Tags         map[string]string `json:"tags"`
+		Disposition  struct {
+			AttachedPic     int `json:"attached_pic"`
+			HearingImpaired int `json:"hearing_impaired"`
+		} `json:"disposition"`
+		SideDataList []struct {
+			SideDataType string  `json:"side_data_type"`
+			Rotation     float64 `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+		Size       string `json:"size"`
+	} `json:"format"`
+}
+
+// parseProbe interprets ffprobe's JSON output for a file, as printed by
+// -print_format json -show_format -show_streams. Streams are matched by type,
+// not position: containers are free to put audio, subtitles or cover art
+// before the video.
+func parseProbe(data []byte) (Info, error) {
+	var jsonOut ffprobeOutput
+	if err := json.Unmarshal(data, &jsonOut); err != nil {
+		return Info{}, err
+	}
+
+	info := Info{}
+	foundVideo := false
+	for _, stream := range jsonOut.Streams {
+		switch stream.CodecType {
+		case "video":
+			if foundVideo || stream.Disposition.AttachedPic == 1 {
+				continue
+			}
+			foundVideo = true
+			info.VideoStream = stream.Index
+			info.Width = stream.Width
+			info.Height = stream.Height
+			info.VideoCodec = stream.CodecName
+			info.PixelFormat = stream.PixFmt
+			info.FrameRate = parseFrameRate(stream.AvgFrameRate)
+			if info.FrameRate == 0 {
+				info.FrameRate = parseFrameRate(stream.RFrameRate)
+			}
+
+			// Older ffmpeg reports rotation as a tag, newer as a display
+			// matrix whose angle runs the other way.
+			if rotate, err := strconv.Atoi(stream.Tags["rotate"]); err == nil {
+				info.Rotation = rotate
+			}
+			for _, sideData := range stream.SideDataList {
+				if sideData.SideDataType == "Display Matrix" {
+					info.Rotation = -int(math.Round(sideData.Rotation))
+				}
+			}
+			info.Rotation = ((info.Rotation % 360) + 360) % 360
+			if info.Rotation == 90 || info.Rotation == 270 {
+				info.Width, info.Height = info.Height, info.Width
+			}
+		case "audio":
+			if !info.HasAudio {
+				info.HasAudio = true
+				info.AudioCodec = stream.CodecName
+				info.AudioChannels = stream.Channels
+			}
+		case "subtitle":
+			info.Subtitles = append(info.Subtitles, SubtitleStream{
+				Index:           stream.Index,
+				Codec:           stream.CodecName,
+				Language:        stream.Tags["language"],
+				Title:           stream.Tags["title"],
+				HearingImpaired: stream.Disposition.HearingImpaired == 1,
+			})
+		}
+	}
+	if !foundVideo || info.Width == 0 || info.Height == 0 {
+		return Info{}, ErrNoVideoStream
+	}
+
+	info.Formats = strings.Split(jsonOut.Format.FormatName, ",")
+	info.Duration, _ = strconv.ParseFloat(jsonOut.Format.Duration, 64)
+	info.BitRate, _ = strconv.ParseInt(jsonOut.Format.BitRate, 10, 64)
+	info.Size, _ = strconv.ParseInt(jsonOut.Format.Size, 10, 64)
+	return info, nil
+}
+
+// parseFrameRate parses an ffprobe rational such as "30000/1001".
+func parseFrameRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	if !ok {
+		f, _ := strconv.ParseFloat(rate, 64)
+		return f
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
@@ -0,0 +1,164 @@
+package media
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// probeJSON wraps streams, a JSON array, in the rest of ffprobe's output for
+// a ten second MP4.
+func probeJSON(streams string) []byte {
+	return []byte(`{
+		"streams": ` + streams + `,
+		"format": {
+			"format_name": "mov,mp4,m4a,3gp,3g2,mj2",
+			"duration": "10.000000",
+			"bit_rate": "4000000",
+			"size": "5000000"
+		}
+	}`)
+}
+
+func TestParseProbe(t *testing.T) {
+	formats := []string{"mov", "mp4", "m4a", "3gp", "3g2", "mj2"}
+	info := func(width, height, rotation int, hasAudio bool) Info {
+		i := Info{
+			Formats:     formats,
+			Width:       width,
+			Height:      height,
+			Rotation:    rotation,
+			VideoCodec:  "h264",
+			PixelFormat: "yuv420p",
+			FrameRate:   30,
+			Duration:    10,
+			BitRate:     4000000,
+			Size:        5000000,
+		}
+		if hasAudio {
+			i.HasAudio = true
+			i.AudioCodec = "aac"
+			i.AudioChannels = 2
+		}
+		return i
+	}
+	video := func(index, width, height int, extra string) string {
+		return `{"index": ` + strconv.Itoa(index) + `, "codec_type": "video", "codec_name": "h264", "pix_fmt": "yuv420p",
+			"width": ` + strconv.Itoa(width) + `, "height": ` + strconv.Itoa(height) + `,
+			"avg_frame_rate": "30/1", "r_frame_rate": "30/1"` + extra + `}`
+	}
+	audio := `{"index": 1, "codec_type": "audio", "codec_name": "aac", "channels": 2}`
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    Info
+		wantErr error
+	}{
+		{
+			name: "audio stream listed first",
+			data: probeJSON(`[` + audio + `, ` + video(0, 1920, 1080, "") + `]`),
+			want: info(1920, 1080, 0, true),
+		},
+		{
+			name: "cover art before the video",
+			data: probeJSON(`[
+				{"index": 0, "codec_type": "video", "codec_name": "mjpeg", "width": 600, "height": 600,
+					"disposition": {"attached_pic": 1}},
+				` + video(1, 1280, 720, "") + `
+			]`),
+			want: func() Info {
+				i := info(1280, 720, 0, false)
+				i.VideoStream = 1
+				return i
+			}(),
+		},
+		{
+			name: "rotate tag",
+			data: probeJSON(`[` + video(0, 1920, 1080, `, "tags": {"rotate": "90"}`) + `]`),
+			want: info(1080, 1920, 90, false),
+		},
+		{
+			name: "display matrix rotation of -90",
+			data: probeJSON(`[` + video(0, 1920, 1080, `, "side_data_list": [{"side_data_type": "Display Matrix", "rotation": -90}]`) + `]`),
+			want: info(1080, 1920, 90, false),
+		},
+		{
+			name: "display matrix rotation of 90",
+			data: probeJSON(`[` + video(0, 1920, 1080, `, "side_data_list": [{"side_data_type": "Display Matrix", "rotation": 90}]`) + `]`),
+			want: info(1080, 1920, 270, false),
+		},
+		{
+			name:    "zero width",
+			data:    probeJSON(`[` + video(0, 0, 1080, "") + `]`),
+			wantErr: ErrNoVideoStream,
+		},
+		{
+			name:    "zero height",
+			data:    probeJSON(`[` + video(0, 1920, 0, "") + `]`),
+			wantErr: ErrNoVideoStream,
+		},
+		{
+			name:    "no video stream",
+			data:    probeJSON(`[` + audio + `]`),
+			wantErr: ErrNoVideoStream,
+		},
+		{
+			name: "16:9",
+			data: probeJSON(`[` + video(0, 1280, 720, "") + `]`),
+			want: info(1280, 720, 0, false),
+		},
+		{
+			name: "9:16",
+			data: probeJSON(`[` + video(0, 720, 1280, "") + `]`),
+			want: info(720, 1280, 0, false),
+		},
+		{
+			name: "1:1",
+			data: probeJSON(`[` + video(0, 1080, 1080, "") + `]`),
+			want: info(1080, 1080, 0, false),
+		},
+		{
+			name: "4:3",
+			data: probeJSON(`[` + video(0, 1440, 1080, "") + `]`),
+			want: info(1440, 1080, 0, false),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseProbe(tc.data)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("parseProbe() error = %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseProbe() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseProbe() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseFrameRate(t *testing.T) {
+	tests := []struct {
+		rate string
+		want float64
+	}{
+		{"30/1", 30},
+		{"30000/1001", 30000.0 / 1001.0},
+		{"25", 25},
+		{"0/0", 0},
+		{"", 0},
+	}
+	for _, tc := range tests {
+		if got := parseFrameRate(tc.rate); got != tc.want {
+			t.Errorf("parseFrameRate(%q) = %v, want %v", tc.rate, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnreadable is returned by Probe when the file isn't a container the
+	// tool can read.
+	ErrUnreadable = errors.New("file isn't readable media")
+	// ErrNoVideoStream is returned by Probe when the file has no video.
+	ErrNoVideoStream = errors.New("no video streams found")
+	// ErrNoFrame is returned by ExtractFrame when no frame matched, such as
+	// when seeking past the end of the video.
+	ErrNoFrame = errors.New("no frame extracted")
+)
+
+// Tool probes and converts media files on local disk. FFmpeg is the real
+// implementation; Fake stands in for it where ffmpeg isn't installed.
+type Tool interface {
+	// Probe describes the first video and audio streams of the file at path.
+	Probe(ctx context.Context, path string) (Info, error)
+	// Remux copies the video stream opts names and the first audio stream of
+	// src into a new container at dst without re-encoding them.
+	Remux(ctx context.Context, src, dst string, opts RemuxOptions) error
+	// Transcode converts src into dst.
+	Transcode(ctx context.Context, src, dst string, opts TranscodeOptions) error
+	// ExtractFrame writes a single frame of the video at src to dst as an
+	// image, in the format dst's extension names.
+	ExtractFrame(ctx context.Context, src, dst string, opts FrameOptions) error
+	// Keyframes lists the timestamps of the keyframes in the first video
+	// stream of the file at path.
+	Keyframes(ctx context.Context, path string) ([]time.Duration, error)
+	// Encoders lists the names of the encoders the tool can use.
+	Encoders(ctx context.Context) ([]string, error)
+}
+
+// Info is what probing tells us about a media file. Width and Height are the
+// dimensions the video is displayed at, with Rotation (degrees clockwise)
+// already applied. VideoStream is the index of the video stream described,
+// which isn't necessarily the file's first video stream: cover art is
+// skipped.
+type Info struct {
+	Formats       []string
+	VideoStream   int
+	Width         int
+	Height        int
+	Rotation      int
+	VideoCodec    string
+	PixelFormat   string
+	FrameRate     float64
+	HasAudio      bool
+	AudioCodec    string
+	AudioChannels int
+	Duration      float64
+	BitRate       int64
+	Size          int64
+	Subtitles     []SubtitleStream
+}
+
+// SubtitleStream is a subtitle stream in a media file. Language is the
+// stream's language tag, usually an ISO 639-2 code such as "eng", or empty if
+// it has none.
+type SubtitleStream struct {
+	Index           int
+	Codec           string
+	Language        string
+	Title           string
+	HearingImpaired bool
+}
+
+// textSubtitleCodecs are the subtitle codecs stored as text, rather than as
+// images, which can be converted to WebVTT.
+var textSubtitleCodecs = []string{"subrip", "srt", "ass", "ssa", "webvtt", "mov_text", "text"}
+
+// IsText reports whether the stream holds text that can be converted to
+// WebVTT.
+func (s SubtitleStream) IsText() bool {
+	return slices.Contains(textSubtitleCodecs, s.Codec)
+}
+
+type RemuxOptions struct {
+	// Format is the output container, such as "mp4".
+	Format string
+	// FastStart moves an MP4's index to the front of the file.
+	FastStart bool
+	// VideoStream is the index of the video stream to copy, as reported in
+	// Info.VideoStream.
+	VideoStream int
+	// Start and End, if set, limit the output to that range of the input.
+	// Stream copies can only start cleanly on a keyframe.
+	Start time.Duration
+	End   time.Duration
+}
+
+type TranscodeOptions struct {
+	// Format is the output container, such as "mp4" or "hls". Left empty it
+	// is guessed from dst's extension.
+	Format string
+	// VideoCodec and AudioCodec name the encoders to use, or "copy".
+	VideoCodec string
+	AudioCodec string
+	// Inputs are further files to read alongside src, numbered from 1 in
+	// Filter and Args.
+	Inputs []string
+	// Filter is a filter graph over the inputs, referred to by Args.
+	Filter string
+	// Args are any further output options, in ffmpeg's syntax.
+	Args []string
+	// Start and End, if set, limit the output to that range of the input.
+	Start time.Duration
+	End   time.Duration
+}
+
+type FrameOptions struct {
+	// At is how far into the video to take the frame from.
+	At time.Duration
+	// SceneThreshold, if set, takes the first frame that differs from the
+	// one before it by more than this fraction instead, ignoring At.
+	SceneThreshold float64
+}
+
+// CommandError is returned when a media command fails. It carries the tail
+// of what the command printed to stderr.
+type CommandError struct {
+	Command string
+	Err     error
+	Stderr  string
+}
+
+func (e *CommandError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("%s: %v", e.Command, e.Err)
+	}
+	return fmt.Sprintf("%s: %v: %s", e.Command, e.Err, e.Stderr)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+const maxStderr = 500
+
+func stderrTail(stderr string) string {
+	stderr = strings.TrimSpace(stderr)
+	if len(stderr) > maxStderr {
+		stderr = stderr[len(stderr)-maxStderr:]
+	}
+	return stderr
+}
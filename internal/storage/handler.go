@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Handler serves objects from a Store over HTTP. It is used for the local and
+// in-memory backends; S3 objects are served by S3 or CloudFront directly.
+func Handler(store Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		key := strings.TrimPrefix(r.URL.Path, "/")
+		if isHiddenKey(key) {
+			http.NotFound(w, r)
+			return
+		}
+		body, obj, err := store.Get(r.Context(), key)
+		serveObject(w, r, key, body, obj, err)
+	})
+}
+
+// isHiddenKey reports whether key is under a directory or names a file
+// starting with a dot, such as the local store's in-progress multipart parts,
+// which aren't objects and are never served.
+func isHiddenKey(key string) bool {
+	for _, segment := range strings.Split(key, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Alternate is another encoding of an image, stored next to it under the
+// same key with a different extension.
+type Alternate struct {
+	ContentType string
+	Ext         string
+}
+
+// NegotiatingHandler is Handler, except that requests for JPEG and PNG
+// images are answered with the first of alternates the client explicitly
+// lists in its Accept header and the store has a copy of.
+func NegotiatingHandler(store Store, alternates []Alternate) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		key := strings.TrimPrefix(r.URL.Path, "/")
+		if isHiddenKey(key) {
+			http.NotFound(w, r)
+			return
+		}
+		switch strings.ToLower(path.Ext(key)) {
+		case ".jpg", ".jpeg", ".png":
+			w.Header().Add("Vary", "Accept")
+			accept := r.Header.Get("Accept")
+			for _, alt := range alternates {
+				if !acceptsExplicitly(accept, alt.ContentType) {
+					continue
+				}
+				altKey := strings.TrimSuffix(key, path.Ext(key)) + alt.Ext
+				body, obj, err := store.Get(r.Context(), altKey)
+				if errors.Is(err, ErrNotFound) {
+					continue
+				}
+				serveObject(w, r, altKey, body, obj, err)
+				return
+			}
+		}
+
+		body, obj, err := store.Get(r.Context(), key)
+		serveObject(w, r, key, body, obj, err)
+	})
+}
+
+func serveObject(w http.ResponseWriter, r *http.Request, key string, body io.ReadCloser, obj Object, err error) {
+	if errors.Is(err, ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	if obj.ContentType != "" {
+		w.Header().Set("Content-Type", obj.ContentType)
+	}
+	if rs, ok := body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, key, obj.LastModified, rs)
+		return
+	}
+	io.Copy(w, body)
+}
+
+// acceptsExplicitly reports whether an Accept header names contentType with
+// a non-zero quality. Wildcards don't count: clients that send */* aren't
+// necessarily able to decode newer image formats.
+func acceptsExplicitly(accept, contentType string) bool {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(mediaRange, ";")
+		if !strings.EqualFold(strings.TrimSpace(mediaType), contentType) {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(name) == "q" {
+				q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				return err == nil && q > 0
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LocalStore keeps objects as plain files under a root directory.
+type LocalStore struct {
+	root    string
+	baseURL string
+}
+
+func NewLocalStore(root, baseURL string) (*LocalStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{
+		root:    root,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}, nil
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	fullPath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temp file first so readers never see a partial object.
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fullPath)
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	fullPath, err := s.path(key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return nil, Object{}, localError(err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, Object{}, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, Object{}, ErrNotFound
+	}
+	return file, localObject(key, info), nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	fullPath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(fullPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalStore) Head(ctx context.Context, key string) (Object, error) {
+	fullPath, err := s.path(key)
+	if err != nil {
+		return Object{}, err
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return Object{}, localError(err)
+	}
+	if info.IsDir() {
+		return Object{}, ErrNotFound
+	}
+	return localObject(key, info), nil
+}
+
+func (s *LocalStore) List(ctx context.Context, prefix string) ([]Object, error) {
+	objects := []Object{}
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && p != s.root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, localObject(key, info))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+func (s *LocalStore) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return s.URL(key), nil
+}
+
+func (s *LocalStore) URL(key string) string {
+	return s.baseURL + "/" + key
+}
+
+func (s *LocalStore) Bucket() string {
+	return filepath.Base(s.root)
+}
+
+func localObject(key string, info fs.FileInfo) Object {
+	return Object{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+		LastModified: info.ModTime(),
+	}
+}
+
+func localError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	return err
+}
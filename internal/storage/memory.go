@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps objects in memory. It is meant for tests and local
+// development; everything is lost when the process exits.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+	uploads map[string]*memoryUpload
+	baseURL string
+}
+
+type memoryObject struct {
+	data        []byte
+	contentType string
+	modified    time.Time
+}
+
+func NewMemoryStore(baseURL string) *MemoryStore {
+	return &MemoryStore{
+		objects: map[string]memoryObject{},
+		uploads: map[string]*memoryUpload{},
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+func (s *MemoryStore) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = memoryObject{
+		data:        data,
+		contentType: contentType,
+		modified:    time.Now().UTC(),
+	}
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	obj, ok := s.objects[key]
+	if !ok {
+		return nil, Object{}, ErrNotFound
+	}
+	return readSeekNopCloser{bytes.NewReader(obj.data)}, obj.info(key), nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *MemoryStore) Head(ctx context.Context, key string) (Object, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	obj, ok := s.objects[key]
+	if !ok {
+		return Object{}, ErrNotFound
+	}
+	return obj.info(key), nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, prefix string) ([]Object, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	objects := []Object{}
+	for key, obj := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, obj.info(key))
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	return objects, nil
+}
+
+func (s *MemoryStore) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	return s.URL(key), nil
+}
+
+func (s *MemoryStore) URL(key string) string {
+	return s.baseURL + "/" + key
+}
+
+func (s *MemoryStore) Bucket() string {
+	return "memory"
+}
+
+func (obj memoryObject) info(key string) Object {
+	return Object{
+		Key:          key,
+		Size:         int64(len(obj.data)),
+		ContentType:  obj.contentType,
+		LastModified: obj.modified,
+	}
+}
+
+type readSeekNopCloser struct {
+	*bytes.Reader
+}
+
+func (readSeekNopCloser) Close() error { return nil }
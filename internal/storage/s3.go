@@ -0,0 +1,361 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+type S3Store struct {
+	client      *s3.Client
+	presign     *s3.PresignClient
+	bucket      string
+	region      string
+	partSize    int64
+	concurrency int
+}
+
+// S3Options controls how Put uploads large objects. Bodies larger than
+// PartSize are sent as a multipart upload with up to Concurrency parts in
+// flight; a zero PartSize disables multipart uploads.
+type S3Options struct {
+	PartSize    int64
+	Concurrency int
+}
+
+func NewS3Store(client *s3.Client, bucket, region string, opts S3Options) (*S3Store, error) {
+	if opts.PartSize != 0 && opts.PartSize < MinPartSize {
+		return nil, fmt.Errorf("part size must be at least %d bytes", MinPartSize)
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	return &S3Store{
+		client:      client,
+		presign:     s3.NewPresignClient(client),
+		bucket:      bucket,
+		region:      region,
+		partSize:    opts.PartSize,
+		concurrency: opts.Concurrency,
+	}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	if s.partSize == 0 {
+		return s.putObject(ctx, key, body, contentType)
+	}
+
+	first := make([]byte, s.partSize)
+	n, err := io.ReadFull(body, first)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return s.putObject(ctx, key, bytes.NewReader(first[:n]), contentType)
+	}
+	if err != nil {
+		return err
+	}
+	return s.putMultipart(ctx, key, io.MultiReader(bytes.NewReader(first), body), contentType)
+}
+
+func (s *S3Store) putObject(ctx context.Context, key string, body io.Reader, contentType string) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+	})
+	return err
+}
+
+// putMultipart reads body in partSize chunks and uploads them in parallel.
+// The upload is aborted if any part fails.
+func (s *S3Store) putMultipart(ctx context.Context, key string, body io.Reader, contentType string) error {
+	uploadID, err := s.CreateMultipartUpload(ctx, key, contentType)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		parts    []Part
+		firstErr error
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+
+	sem := make(chan struct{}, s.concurrency)
+	for number := int32(1); ctx.Err() == nil; number++ {
+		sem <- struct{}{}
+		chunk := make([]byte, s.partSize)
+		n, err := io.ReadFull(body, chunk)
+		if err == io.EOF {
+			<-sem
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			<-sem
+			fail(err)
+			break
+		}
+
+		wg.Add(1)
+		go func(number int32, chunk []byte) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			part, err := s.UploadPart(ctx, key, uploadID, number, bytes.NewReader(chunk), int64(len(chunk)))
+			if err != nil {
+				fail(fmt.Errorf("couldn't upload part %d: %w", number, err))
+				return
+			}
+			mu.Lock()
+			parts = append(parts, part)
+			mu.Unlock()
+		}(number, chunk[:n])
+
+		if err == io.ErrUnexpectedEOF {
+			break
+		}
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		s.AbortMultipartUpload(context.WithoutCancel(ctx), key, uploadID)
+		return firstErr
+	}
+	return s.CompleteMultipartUpload(ctx, key, uploadID, parts)
+}
+
+func (s *S3Store) CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	out, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.UploadId), nil
+}
+
+func (s *S3Store) UploadPart(ctx context.Context, key, uploadID string, number int32, body io.ReadSeeker, size int64) (Part, error) {
+	out, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int32(number),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return Part{}, s3Error(err)
+	}
+	return Part{
+		Number: number,
+		ETag:   aws.ToString(out.ETag),
+		Size:   size,
+	}, nil
+}
+
+func (s *S3Store) ListParts(ctx context.Context, key, uploadID string) ([]Part, error) {
+	paginator := s3.NewListPartsPaginator(s.client, &s3.ListPartsInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+
+	parts := []Part{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, s3Error(err)
+		}
+		for _, p := range page.Parts {
+			parts = append(parts, Part{
+				Number: aws.ToInt32(p.PartNumber),
+				ETag:   aws.ToString(p.ETag),
+				Size:   aws.ToInt64(p.Size),
+			})
+		}
+	}
+	return parts, nil
+}
+
+func (s *S3Store) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) error {
+	sortParts(parts)
+	completed := make([]types.CompletedPart, len(parts))
+	for i, p := range parts {
+		completed[i] = types.CompletedPart{
+			PartNumber: aws.Int32(p.Number),
+			ETag:       aws.String(p.ETag),
+		}
+	}
+	_, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{
+			Parts: completed,
+		},
+	})
+	return s3Error(err)
+}
+
+func (s *S3Store) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	return s3Error(err)
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, Object{}, s3Error(err)
+	}
+	return out.Body, Object{
+		Key:          key,
+		Size:         aws.ToInt64(out.ContentLength),
+		ContentType:  aws.ToString(out.ContentType),
+		LastModified: aws.ToTime(out.LastModified),
+	}, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return s3Error(err)
+}
+
+func (s *S3Store) Head(ctx context.Context, key string) (Object, error) {
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return Object{}, s3Error(err)
+	}
+	return Object{
+		Key:          key,
+		Size:         aws.ToInt64(out.ContentLength),
+		ContentType:  aws.ToString(out.ContentType),
+		LastModified: aws.ToTime(out.LastModified),
+	}, nil
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string) ([]Object, error) {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	objects := []Object{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, s3Error(err)
+		}
+		for _, obj := range page.Contents {
+			objects = append(objects, Object{
+				Key:          aws.ToString(obj.Key),
+				Size:         aws.ToInt64(obj.Size),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+	return objects, nil
+}
+
+func (s *S3Store) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	req, err := s.presign.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
+
+func (s *S3Store) PresignPut(ctx context.Context, key, contentType string, size int64, expires time.Duration) (string, error) {
+	req, err := s.presign.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
+
+func (s *S3Store) PresignPost(ctx context.Context, key, contentType string, maxSize int64, expires time.Duration) (PresignedPost, error) {
+	req, err := s.presign.PresignPostObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}, func(opts *s3.PresignPostOptions) {
+		opts.Expires = expires
+		opts.Conditions = []interface{}{
+			[]interface{}{"content-length-range", 1, maxSize},
+			map[string]string{"Content-Type": contentType},
+		}
+	})
+	if err != nil {
+		return PresignedPost{}, err
+	}
+
+	fields := map[string]string{}
+	for k, v := range req.Values {
+		fields[k] = v
+	}
+	fields["Content-Type"] = contentType
+	return PresignedPost{
+		URL:    req.URL,
+		Fields: fields,
+	}, nil
+}
+
+func (s *S3Store) URL(key string) string {
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, s.region, key)
+}
+
+func (s *S3Store) Bucket() string {
+	return s.bucket
+}
+
+// s3Error maps S3's missing object errors onto ErrNotFound.
+func s3Error(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NotFound", "NoSuchUpload":
+			return fmt.Errorf("%w: %v", ErrNotFound, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"time"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// Object describes a stored object without its contents.
+type Object struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// Store is the object storage backend used for videos and assets. Keys are
+// slash separated paths such as "landscape/abc123.mp4".
+type Store interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, Object, error)
+	Delete(ctx context.Context, key string) error
+	Head(ctx context.Context, key string) (Object, error)
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// PresignGet returns a URL that grants read access to key for the given
+	// duration. Backends that cannot expire links return their public URL.
+	PresignGet(ctx context.Context, key string, expires time.Duration) (string, error)
+	// URL returns the permanent public URL for key.
+	URL(key string) string
+	// Bucket names the bucket, or its local equivalent, objects live in.
+	Bucket() string
+}
+
+// UploadPresigner is implemented by stores that can hand clients a URL to
+// upload an object directly, bypassing the API server.
+type UploadPresigner interface {
+	// PresignPut returns a URL for a single PUT of exactly size bytes.
+	PresignPut(ctx context.Context, key, contentType string, size int64, expires time.Duration) (string, error)
+	// PresignPost returns a browser form upload restricted to contentType and
+	// at most maxSize bytes.
+	PresignPost(ctx context.Context, key, contentType string, maxSize int64, expires time.Duration) (PresignedPost, error)
+}
+
+// PresignedPost is an HTML form upload: Fields must be sent as form values
+// before the file itself.
+type PresignedPost struct {
+	URL    string            `json:"url"`
+	Fields map[string]string `json:"fields"`
+}
+
+// MinPartSize is the smallest part S3 accepts, other than the last one.
+const MinPartSize = 5 << 20
+
+// Part is one uploaded piece of a multipart upload.
+type Part struct {
+	Number int32  `json:"number"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+}
+
+// MultipartUploader is implemented by stores that can assemble an object from
+// independently uploaded parts, so an interrupted upload can be resumed.
+type MultipartUploader interface {
+	CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error)
+	UploadPart(ctx context.Context, key, uploadID string, number int32, body io.ReadSeeker, size int64) (Part, error)
+	ListParts(ctx context.Context, key, uploadID string) ([]Part, error)
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) error
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+}
+
+func sortParts(parts []Part) {
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].Number < parts[j].Number
+	})
+}
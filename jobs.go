@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// Uploaded videos are processed in the background: upload handlers persist
+// the source file, enqueue a job and respond immediately, and a pool of
+// workers claims jobs from the jobs table, retrying failures with
+// exponential backoff.
+
+const (
+	jobKindProcessVideo = "process_video"
+
+	jobPollInterval = 2 * time.Second
+	jobRetryBase    = 10 * time.Second
+	jobRetryMax     = 10 * time.Minute
+)
+
+// errJobVideoDeleted is returned by jobs whose video was deleted, which no
+// number of retries can fix.
+var errJobVideoDeleted = errors.New("video no longer exists")
+
+// processVideoPayload names where a job's source video lives: a file in
+// processingDir, an object a client uploaded straight to the video store, or
+// a range of another video, which is left in place.
+type processVideoPayload struct {
+	SourcePath string `json:"source_path,omitempty"`
+	// SourceHash is the SHA-256 of the file at SourcePath, taken while it
+	// was staged.
+	SourceHash string       `json:"source_hash,omitempty"`
+	SourceKey  string       `json:"source_key,omitempty"`
+	Clip       *clipPayload `json:"clip,omitempty"`
+}
+
+// enqueueVideoProcessing marks video as processing and queues a job for it.
+func (cfg *apiConfig) enqueueVideoProcessing(video database.Video, payload processVideoPayload) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	err = cfg.db.TransitionVideoStatus(video.ID, database.VideoStatusProcessing, "")
+	if err != nil {
+		return err
+	}
+
+	_, err = cfg.db.CreateJob(database.CreateJobParams{
+		VideoID:     video.ID,
+		Kind:        jobKindProcessVideo,
+		Payload:     string(data),
+		MaxAttempts: cfg.jobMaxAttempts,
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case cfg.jobsWake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// newProcessingFile creates a file in processingDir that outlives the request
+// so a worker can pick it up later.
+func (cfg *apiConfig) newProcessingFile() (*os.File, error) {
+	return os.CreateTemp(cfg.processingDir, "upload-*")
+}
+
+func (cfg *apiConfig) startJobWorkers(ctx context.Context, workers int) {
+	if err := cfg.db.RequeueRunningJobs(); err != nil {
+		log.Printf("Couldn't requeue interrupted jobs: %v", err)
+	}
+	for i := 0; i < workers; i++ {
+		go cfg.runJobWorker(ctx)
+	}
+}
+
+func (cfg *apiConfig) runJobWorker(ctx context.Context) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, err := cfg.db.ClaimJob(time.Now())
+		if err != nil {
+			log.Printf("Couldn't claim job: %v", err)
+		}
+		if err == nil && job.ID != uuid.Nil {
+			cfg.runJob(ctx, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-cfg.jobsWake:
+		}
+	}
+}
+
+func (cfg *apiConfig) runJob(ctx context.Context, job database.Job) {
+	jobCtx, cancel := context.WithTimeout(ctx, cfg.jobTimeout)
+	defer cancel()
+
+	var err error
+	switch job.Kind {
+	case jobKindProcessVideo:
+		err = cfg.runProcessVideoJob(jobCtx, job)
+	default:
+		err = fmt.Errorf("unknown job kind %q", job.Kind)
+	}
+
+	if err == nil {
+		if err := cfg.db.CompleteJob(job.ID); err != nil {
+			log.Printf("Couldn't mark job %s complete: %v", job.ID, err)
+		}
+		return
+	}
+
+	log.Printf("Job %s (%s) attempt %d failed: %v", job.ID, job.Kind, job.Attempts, err)
+	if errors.Is(err, errJobVideoDeleted) {
+		if err := cfg.db.FailJob(job.ID, err.Error()); err != nil {
+			log.Printf("Couldn't mark job %s failed: %v", job.ID, err)
+		}
+		return
+	}
+	if job.Attempts < job.MaxAttempts {
+		if err := cfg.db.RetryJob(job.ID, err.Error(), time.Now().Add(jobBackoff(job.Attempts))); err != nil {
+			log.Printf("Couldn't requeue job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	if err := cfg.db.FailJob(job.ID, err.Error()); err != nil {
+		log.Printf("Couldn't mark job %s failed: %v", job.ID, err)
+	}
+	cfg.failVideoJob(job, err)
+}
+
+// jobBackoff doubles the delay after each failed attempt, up to jobRetryMax.
+func jobBackoff(attempts int) time.Duration {
+	delay := jobRetryBase
+	for i := 1; i < attempts && delay < jobRetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, jobRetryMax)
+}
+
+func (cfg *apiConfig) runProcessVideoJob(ctx context.Context, job database.Job) error {
+	var payload processVideoPayload
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return err
+	}
+
+	video, err := cfg.db.GetVideo(job.VideoID)
+	if err != nil {
+		return err
+	}
+	if video.ID == uuid.Nil {
+		cfg.cleanupJobSource(payload)
+		return fmt.Errorf("video %s: %w", job.VideoID, errJobVideoDeleted)
+	}
+
+	sourcePath, sourceHash := payload.SourcePath, payload.SourceHash
+	if payload.SourceKey != "" {
+		sourcePath, sourceHash, err = cfg.downloadToTemp(ctx, payload.SourceKey)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(sourcePath)
+	}
+	if payload.Clip != nil {
+		sourcePath, err = cfg.cutClip(ctx, *payload.Clip)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(sourcePath)
+	}
+
+	err = cfg.processAndStoreVideo(ctx, video, sourcePath, sourceHash)
+	if err != nil && !errors.Is(err, errJobVideoDeleted) {
+		// A step may have failed because the video was deleted while it was
+		// processing.
+		if current, getErr := cfg.db.GetVideo(video.ID); getErr == nil && current.ID == uuid.Nil {
+			err = errJobVideoDeleted
+		}
+	}
+	if errors.Is(err, errJobVideoDeleted) {
+		cfg.cleanupJobSource(payload)
+		return fmt.Errorf("video %s: %w", job.VideoID, errJobVideoDeleted)
+	}
+	if err != nil {
+		return err
+	}
+
+	cfg.cleanupJobSource(payload)
+	return nil
+}
+
+// failVideoJob marks the job's video as failed once retries are exhausted.
+func (cfg *apiConfig) failVideoJob(job database.Job, jobErr error) {
+	var payload processVideoPayload
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err == nil {
+		cfg.cleanupJobSource(payload)
+	}
+
+	err := cfg.db.TransitionVideoStatus(job.VideoID, database.VideoStatusFailed, jobErr.Error())
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Couldn't mark video %s failed: %v", job.VideoID, err)
+	}
+}
+
+// cleanupJobSource discards a job's source once the job is finished with it,
+// successfully or not.
+func (cfg *apiConfig) cleanupJobSource(payload processVideoPayload) {
+	if payload.SourcePath != "" {
+		os.Remove(payload.SourcePath)
+	}
+	if payload.SourceKey != "" {
+		if err := cfg.videoStore.Delete(context.Background(), payload.SourceKey); err != nil {
+			log.Printf("Couldn't delete staged upload %s: %v", payload.SourceKey, err)
+		}
+	}
+	if payload.Clip != nil {
+		sourceRef := storageRef(cfg.videoStore.Bucket(), payload.Clip.SourceKey)
+		cfg.releaseBlob(cfg.videoStore, &sourceRef)
+	}
+}
+
+// downloadToTemp copies the object at key to a temporary file, returning its
+// path and the SHA-256 of its contents.
+func (cfg *apiConfig) downloadToTemp(ctx context.Context, key string) (string, string, error) {
+	body, _, err := cfg.videoStore.Get(ctx, key)
+	if err != nil {
+		return "", "", err
+	}
+	defer body.Close()
+
+	tempFile, err := os.CreateTemp("", "tubely-upload-*")
+	if err != nil {
+		return "", "", err
+	}
+	defer tempFile.Close()
+
+	hasher := newBlobHasher()
+	if _, err := io.Copy(tempFile, io.TeeReader(body, hasher)); err != nil {
+		os.Remove(tempFile.Name())
+		return "", "", fmt.Errorf("couldn't download %s: %w", key, err)
+	}
+	return tempFile.Name(), hasher.Sum(), nil
+}
@@ -5,26 +5,52 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/cloudfront"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
-	db               database.Client
-	s3Client		*s3.Client
-	jwtSecret        string
-	platform         string
-	filepathRoot     string
-	assetsRoot       string
-	s3Bucket         string
-	s3Region         string
-	s3CfDistribution string
-	port             string
+	db                  database.Client
+	videoStore          storage.Store
+	assetStore          storage.Store
+	jwtSecret           string
+	platform            string
+	filepathRoot        string
+	assetsRoot          string
+	s3Bucket            string
+	s3Region            string
+	s3CfDistribution    string
+	videoURLExpiry      time.Duration
+	partSize            int64
+	tusDir              string
+	tusExpiry           time.Duration
+	processingDir       string
+	jobMaxAttempts      int
+	jobTimeout          time.Duration
+	jobsWake            chan struct{}
+	outputFormats       []string
+	keepOriginalVideo   bool
+	generatePreviews    bool
+	audioRendition      string
+	watermark           *watermark
+	videoRenditions     []videoRendition
+	thumbnailMode       string
+	thumbnailTimestamp  time.Duration
+	thumbnailAlternates []imageAlternate
+	media               media.Tool
+	cfSigner            *cloudfront.Signer
+	cfSigningMode       string
+	cfCookieDomain      string
+	port                string
 }
 
 func main() {
@@ -40,13 +66,6 @@ func main() {
 		log.Fatalf("Couldn't connect to database: %v", err)
 	}
 
-	awsCfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(os.Getenv("S3_REGION")))
-	if err != nil {
-		log.Fatal("Could not load default AWS config.")
-	}
-
-	s3Client := s3.NewFromConfig(awsCfg)
-	
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
 		log.Fatal("JWT_SECRET environment variable is not set")
@@ -67,37 +86,280 @@ func main() {
 		log.Fatal("ASSETS_ROOT environment variable is not set")
 	}
 
+	videoBackend := os.Getenv("VIDEO_STORAGE")
+	if videoBackend == "" {
+		videoBackend = storageBackendS3
+	}
+
+	assetBackend := os.Getenv("ASSET_STORAGE")
+	if assetBackend == "" {
+		assetBackend = storageBackendLocal
+	}
+
+	mediaRoot := os.Getenv("MEDIA_ROOT")
+	if videoBackend == storageBackendLocal && mediaRoot == "" {
+		log.Fatal("MEDIA_ROOT environment variable is not set")
+	}
+
+	usesS3 := videoBackend == storageBackendS3 || assetBackend == storageBackendS3
+
 	s3Bucket := os.Getenv("S3_BUCKET")
-	if s3Bucket == "" {
+	if usesS3 && s3Bucket == "" {
 		log.Fatal("S3_BUCKET environment variable is not set")
 	}
 
 	s3Region := os.Getenv("S3_REGION")
-	if s3Region == "" {
+	if usesS3 && s3Region == "" {
 		log.Fatal("S3_REGION environment variable is not set")
 	}
 
 	s3CfDistribution := os.Getenv("S3_CF_DISTRO")
-	if s3CfDistribution == "" {
+	if usesS3 && s3CfDistribution == "" {
 		log.Fatal("S3_CF_DISTRO environment variable is not set")
 	}
 
+	videoURLExpiry := 15 * time.Minute
+	if expiry := os.Getenv("VIDEO_URL_EXPIRY"); expiry != "" {
+		videoURLExpiry, err = time.ParseDuration(expiry)
+		if err != nil || videoURLExpiry <= 0 {
+			log.Fatalf("VIDEO_URL_EXPIRY must be a positive duration such as 15m: %v", expiry)
+		}
+	}
+
+	var cfSigner *cloudfront.Signer
+	cfKeyPairID := os.Getenv("CF_KEY_PAIR_ID")
+	cfPrivateKeyPath := os.Getenv("CF_PRIVATE_KEY_PATH")
+	if cfKeyPairID != "" || cfPrivateKeyPath != "" {
+		if s3CfDistribution == "" {
+			log.Fatal("S3_CF_DISTRO environment variable is required for CloudFront signing")
+		}
+		privateKey, err := os.ReadFile(cfPrivateKeyPath)
+		if err != nil {
+			log.Fatalf("Couldn't read CloudFront private key: %v", err)
+		}
+		cfSigner, err = cloudfront.NewSigner(cfKeyPairID, privateKey)
+		if err != nil {
+			log.Fatalf("Couldn't load CloudFront private key: %v", err)
+		}
+	}
+
+	cfSigningMode := os.Getenv("CF_SIGNING_MODE")
+	if cfSigningMode == "" {
+		cfSigningMode = cfSigningURL
+	}
+	if cfSigningMode != cfSigningURL && cfSigningMode != cfSigningCookie {
+		log.Fatalf("CF_SIGNING_MODE must be %q or %q", cfSigningURL, cfSigningCookie)
+	}
+
+	cfCookieDomain := os.Getenv("CF_COOKIE_DOMAIN")
+
+	tusDir := os.Getenv("TUS_DIR")
+	if tusDir == "" {
+		tusDir = filepath.Join(os.TempDir(), "tubely-tus")
+	}
+	if err := os.MkdirAll(tusDir, 0755); err != nil {
+		log.Fatalf("Couldn't create tus upload directory: %v", err)
+	}
+
+	tusExpiry := 24 * time.Hour
+	if expiry := os.Getenv("TUS_EXPIRY"); expiry != "" {
+		tusExpiry, err = time.ParseDuration(expiry)
+		if err != nil || tusExpiry <= 0 {
+			log.Fatalf("TUS_EXPIRY must be a positive duration such as 24h: %v", expiry)
+		}
+	}
+
+	processingDir := os.Getenv("PROCESSING_DIR")
+	if processingDir == "" {
+		processingDir = filepath.Join(os.TempDir(), "tubely-processing")
+	}
+	if err := os.MkdirAll(processingDir, 0755); err != nil {
+		log.Fatalf("Couldn't create processing directory: %v", err)
+	}
+
+	jobWorkers := 2
+	if workers := os.Getenv("JOB_WORKERS"); workers != "" {
+		jobWorkers, err = strconv.Atoi(workers)
+		if err != nil || jobWorkers < 1 {
+			log.Fatalf("JOB_WORKERS must be a positive integer: %v", workers)
+		}
+	}
+
+	jobMaxAttempts := 5
+	if attempts := os.Getenv("JOB_MAX_ATTEMPTS"); attempts != "" {
+		jobMaxAttempts, err = strconv.Atoi(attempts)
+		if err != nil || jobMaxAttempts < 1 {
+			log.Fatalf("JOB_MAX_ATTEMPTS must be a positive integer: %v", attempts)
+		}
+	}
+
+	jobTimeout := 30 * time.Minute
+	if timeout := os.Getenv("JOB_TIMEOUT"); timeout != "" {
+		jobTimeout, err = time.ParseDuration(timeout)
+		if err != nil || jobTimeout <= 0 {
+			log.Fatalf("JOB_TIMEOUT must be a positive duration such as 30m: %v", timeout)
+		}
+	}
+
+	mediaTimeout := time.Duration(0)
+	if timeout := os.Getenv("MEDIA_TIMEOUT"); timeout != "" {
+		mediaTimeout, err = time.ParseDuration(timeout)
+		if err != nil || mediaTimeout < 0 {
+			log.Fatalf("MEDIA_TIMEOUT must be a duration such as 10m: %v", timeout)
+		}
+	}
+
+	var mediaTool media.Tool
+	switch tool := os.Getenv("MEDIA_TOOL"); tool {
+	case "", mediaToolFFmpeg:
+		mediaTool = media.NewFFmpeg(os.Getenv("FFMPEG_PATH"), os.Getenv("FFPROBE_PATH"), mediaTimeout)
+	case mediaToolFake:
+		mediaTool = media.NewFake()
+	default:
+		log.Fatalf("MEDIA_TOOL must be %q or %q: %v", mediaToolFFmpeg, mediaToolFake, tool)
+	}
+
+	outputFormats := []string{outputFormatMP4}
+	if formats := os.Getenv("OUTPUT_FORMATS"); formats != "" {
+		outputFormats, err = parseOutputFormats(formats)
+		if err != nil {
+			log.Fatalf("OUTPUT_FORMATS must be a comma separated list of %v: %v", supportedOutputFormats, err)
+		}
+	}
+
+	keepOriginalVideo := false
+	if keep := os.Getenv("KEEP_ORIGINAL_VIDEO"); keep != "" {
+		keepOriginalVideo, err = strconv.ParseBool(keep)
+		if err != nil {
+			log.Fatalf("KEEP_ORIGINAL_VIDEO must be true or false: %v", keep)
+		}
+	}
+
+	generatePreviews := true
+	if generate := os.Getenv("GENERATE_PREVIEWS"); generate != "" {
+		generatePreviews, err = strconv.ParseBool(generate)
+		if err != nil {
+			log.Fatalf("GENERATE_PREVIEWS must be true or false: %v", generate)
+		}
+	}
+
+	audioRendition := os.Getenv("AUDIO_RENDITION")
+	if audioRendition == "" {
+		audioRendition = audioRenditionNone
+	}
+	if _, ok := audioFormats[audioRendition]; !ok && audioRendition != audioRenditionNone {
+		log.Fatalf("AUDIO_RENDITION must be %q, %q or %q", audioRenditionNone, audioRenditionAAC, audioRenditionMP3)
+	}
+
+	var videoWatermark *watermark
+	if watermarkImage := os.Getenv("WATERMARK_IMAGE"); watermarkImage != "" {
+		videoWatermark, err = loadWatermark(
+			watermarkImage,
+			os.Getenv("WATERMARK_POSITION"),
+			os.Getenv("WATERMARK_OPACITY"),
+			os.Getenv("WATERMARK_SCALE"),
+		)
+		if err != nil {
+			log.Fatalf("Couldn't load watermark: %v", err)
+		}
+	}
+
+	renditionNames := os.Getenv("VIDEO_RENDITIONS")
+	if renditionNames == "" {
+		renditionNames = defaultVideoRenditions
+	}
+	videoRenditions, err := parseVideoRenditions(renditionNames)
+	if err != nil {
+		log.Fatalf("VIDEO_RENDITIONS must be a comma separated list such as 1080p,720p: %v", err)
+	}
+
+	thumbnailMode := os.Getenv("THUMBNAIL_MODE")
+	if thumbnailMode == "" {
+		thumbnailMode = thumbnailModeTimestamp
+	}
+	if thumbnailMode != thumbnailModeTimestamp && thumbnailMode != thumbnailModeScene && thumbnailMode != thumbnailModeNone {
+		log.Fatalf("THUMBNAIL_MODE must be %q, %q or %q", thumbnailModeTimestamp, thumbnailModeScene, thumbnailModeNone)
+	}
+
+	thumbnailTimestamp := time.Second
+	if timestamp := os.Getenv("THUMBNAIL_TIMESTAMP"); timestamp != "" {
+		thumbnailTimestamp, err = time.ParseDuration(timestamp)
+		if err != nil || thumbnailTimestamp < 0 {
+			log.Fatalf("THUMBNAIL_TIMESTAMP must be a duration such as 1s: %v", timestamp)
+		}
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		log.Fatal("PORT environment variable is not set")
 	}
 
+	multipartPartSize := int64(8 << 20)
+	if partSize := os.Getenv("MULTIPART_PART_SIZE"); partSize != "" {
+		multipartPartSize, err = strconv.ParseInt(partSize, 10, 64)
+		if err != nil || multipartPartSize < storage.MinPartSize {
+			log.Fatalf("MULTIPART_PART_SIZE must be at least %d bytes: %v", storage.MinPartSize, partSize)
+		}
+	}
+
+	multipartConcurrency := 4
+	if concurrency := os.Getenv("MULTIPART_CONCURRENCY"); concurrency != "" {
+		multipartConcurrency, err = strconv.Atoi(concurrency)
+		if err != nil || multipartConcurrency < 1 {
+			log.Fatalf("MULTIPART_CONCURRENCY must be a positive integer: %v", concurrency)
+		}
+	}
+
+	s3Opts := s3StoreOptions{
+		bucket:      s3Bucket,
+		region:      s3Region,
+		partSize:    multipartPartSize,
+		concurrency: multipartConcurrency,
+	}
+
+	videoStore, err := newStore(videoBackend, mediaRoot, "http://localhost:"+port+"/media", s3Opts)
+	if err != nil {
+		log.Fatalf("Couldn't create video storage: %v", err)
+	}
+
+	assetStore, err := newStore(assetBackend, assetsRoot, "http://localhost:"+port+"/assets", s3Opts)
+	if err != nil {
+		log.Fatalf("Couldn't create asset storage: %v", err)
+	}
+
 	cfg := apiConfig{
-		db:               db,
-		s3Client: 		  s3Client,
-		jwtSecret:        jwtSecret,
-		platform:         platform,
-		filepathRoot:     filepathRoot,
-		assetsRoot:       assetsRoot,
-		s3Bucket:         s3Bucket,
-		s3Region:         s3Region,
-		s3CfDistribution: s3CfDistribution,
-		port:             port,
+		db:                  db,
+		videoStore:          videoStore,
+		assetStore:          assetStore,
+		jwtSecret:           jwtSecret,
+		platform:            platform,
+		filepathRoot:        filepathRoot,
+		assetsRoot:          assetsRoot,
+		s3Bucket:            s3Bucket,
+		s3Region:            s3Region,
+		s3CfDistribution:    s3CfDistribution,
+		videoURLExpiry:      videoURLExpiry,
+		partSize:            multipartPartSize,
+		tusDir:              tusDir,
+		tusExpiry:           tusExpiry,
+		processingDir:       processingDir,
+		jobMaxAttempts:      jobMaxAttempts,
+		jobTimeout:          jobTimeout,
+		jobsWake:            make(chan struct{}, 1),
+		outputFormats:       outputFormats,
+		keepOriginalVideo:   keepOriginalVideo,
+		generatePreviews:    generatePreviews,
+		audioRendition:      audioRendition,
+		watermark:           videoWatermark,
+		videoRenditions:     videoRenditions,
+		thumbnailMode:       thumbnailMode,
+		thumbnailTimestamp:  thumbnailTimestamp,
+		thumbnailAlternates: detectImageAlternates(context.Background(), mediaTool),
+		media:               mediaTool,
+		cfSigner:            cfSigner,
+		cfSigningMode:       cfSigningMode,
+		cfCookieDomain:      cfCookieDomain,
+		port:                port,
 	}
 
 	err = cfg.ensureAssetsDir()
@@ -109,8 +371,19 @@ func main() {
 	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
 	mux.Handle("/app/", appHandler)
 
-	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(assetsRoot)))
-	mux.Handle("/assets/", noCacheMiddleware(assetsHandler))
+	if assetBackend != storageBackendS3 {
+		alternates := []storage.Alternate{}
+		for _, alt := range cfg.thumbnailAlternates {
+			alternates = append(alternates, storage.Alternate{ContentType: alt.ContentType, Ext: "." + alt.Ext})
+		}
+		assetsHandler := http.StripPrefix("/assets", storage.NegotiatingHandler(assetStore, alternates))
+		mux.Handle("/assets/", noCacheMiddleware(assetsHandler))
+	}
+
+	if videoBackend != storageBackendS3 {
+		mediaHandler := http.StripPrefix("/media", publishedMediaOnly(storage.Handler(videoStore)))
+		mux.Handle("/media/", noCacheMiddleware(mediaHandler))
+	}
 
 	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
 	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
@@ -118,15 +391,35 @@ func main() {
 
 	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
 
+	mux.HandleFunc("POST /api/cdn_cookies", cfg.handlerCDNCookies)
+
 	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
 	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
 	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/presign", cfg.handlerUploadVideoPresign)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/complete", cfg.handlerUploadVideoComplete)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/multipart", cfg.handlerMultipartCreate)
+	mux.HandleFunc("GET /api/video_upload/{videoID}/multipart", cfg.handlerMultipartList)
+	mux.HandleFunc("PUT /api/video_upload/{videoID}/multipart/{partNumber}", cfg.handlerMultipartUploadPart)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/multipart/complete", cfg.handlerMultipartComplete)
+	mux.HandleFunc("DELETE /api/video_upload/{videoID}/multipart", cfg.handlerMultipartAbort)
+	mux.HandleFunc("OPTIONS /api/tus/", cfg.handlerTusOptions)
+	mux.HandleFunc("POST /api/tus/{$}", cfg.handlerTusCreate)
+	mux.HandleFunc("HEAD /api/tus/{uploadID}", cfg.handlerTusHead)
+	mux.HandleFunc("PATCH /api/tus/{uploadID}", cfg.handlerTusPatch)
+	mux.HandleFunc("DELETE /api/tus/{uploadID}", cfg.handlerTusDelete)
 	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
 	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
 	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
+	mux.HandleFunc("POST /api/videos/{videoID}/clips", cfg.handlerVideoClip)
+	mux.HandleFunc("PUT /api/videos/{videoID}/captions/{language}", cfg.handlerCaptionUpload)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/captions/{language}", cfg.handlerCaptionDelete)
 
 	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
 
+	go cfg.cleanupExpiredTusUploads(10 * time.Minute)
+	cfg.startJobWorkers(context.Background(), jobWorkers)
+
 	srv := &http.Server{
 		Addr:    ":" + port,
 		Handler: mux,
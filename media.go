@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+const (
+	mediaToolFFmpeg = "ffmpeg"
+	mediaToolFake   = "fake"
+)
+
+// videoMetadata converts what probing a video found into the metadata stored
+// on it.
+func videoMetadata(info media.Info) database.VideoMetadata {
+	m := database.VideoMetadata{
+		Duration:   &info.Duration,
+		VideoCodec: &info.VideoCodec,
+		BitRate:    &info.BitRate,
+		FrameRate:  &info.FrameRate,
+		Width:      &info.Width,
+		Height:     &info.Height,
+		Rotation:   &info.Rotation,
+		FileSize:   &info.Size,
+	}
+	if info.HasAudio {
+		m.AudioCodec = &info.AudioCodec
+		m.AudioChannels = &info.AudioChannels
+	}
+	return m
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+// normalizeToMP4 writes a web-playable copy of the video at sourcePath to a
+// new file and returns its path: an MP4 with H.264 video and AAC audio, its
+// index moved to the front so playback can start before the download
+// finishes. Streams already in a playable codec are copied rather than
+// re-encoded, so MP4s and most MOVs are only remuxed. Only the probed video
+// stream and the first audio stream are kept.
+func (cfg *apiConfig) normalizeToMP4(ctx context.Context, sourcePath string) (string, error) {
+	info, err := cfg.media.Probe(ctx, sourcePath)
+	if err != nil {
+		return "", fmt.Errorf("couldn't probe video: %w", err)
+	}
+
+	outPath := fmt.Sprintf("%s.processing", sourcePath)
+	copyVideo := info.VideoCodec == "h264" && info.PixelFormat == "yuv420p"
+	copyAudio := !info.HasAudio || info.AudioCodec == "aac"
+	if copyVideo && copyAudio {
+		err = cfg.media.Remux(ctx, sourcePath, outPath, media.RemuxOptions{Format: "mp4", FastStart: true, VideoStream: info.VideoStream})
+		if err != nil {
+			return "", err
+		}
+		return outPath, nil
+	}
+
+	opts := media.TranscodeOptions{
+		Format: "mp4",
+		Args:   []string{"-map", fmt.Sprintf("0:%d", info.VideoStream), "-map", "0:a:0?"},
+	}
+	if copyVideo {
+		opts.VideoCodec = "copy"
+	} else {
+		opts.VideoCodec = "libx264"
+		opts.Args = append(opts.Args, "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p")
+	}
+	if copyAudio {
+		opts.AudioCodec = "copy"
+	} else {
+		opts.AudioCodec = "aac"
+		opts.Args = append(opts.Args, "-b:a", "160k", "-ac", "2")
+	}
+	opts.Args = append(opts.Args, "-movflags", "+faststart")
+
+	if err := cfg.media.Transcode(ctx, sourcePath, outPath, opts); err != nil {
+		return "", err
+	}
+	return outPath, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"math"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+// Videos are stored under a prefix naming their orientation.
+const (
+	orientationLandscape = "landscape"
+	orientationPortrait  = "portrait"
+	orientationSquare    = "square"
+	orientationOther     = "other"
+)
+
+// orientationTolerance is how far apart, relative to the longer side, a
+// video's width and height may be for it to still count as square.
+const orientationTolerance = 0.03
+
+// videoOrientation classifies a video by the dimensions it is displayed at,
+// so a portrait phone recording stored as rotated landscape frames is
+// portrait. Videos with unknown dimensions are other.
+func videoOrientation(probe media.Info) string {
+	if probe.Width <= 0 || probe.Height <= 0 {
+		return orientationOther
+	}
+
+	width, height := float64(probe.Width), float64(probe.Height)
+	switch {
+	case math.Abs(width-height) <= math.Max(width, height)*orientationTolerance:
+		return orientationSquare
+	case width > height:
+		return orientationLandscape
+	default:
+		return orientationPortrait
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+func TestVideoOrientation(t *testing.T) {
+	tests := []struct {
+		name   string
+		width  int
+		height int
+		want   string
+	}{
+		{"16:9", 1920, 1080, orientationLandscape},
+		{"4:3", 1440, 1080, orientationLandscape},
+		{"21:9", 2560, 1080, orientationLandscape},
+		{"9:16", 1080, 1920, orientationPortrait},
+		{"3:4", 1080, 1440, orientationPortrait},
+		{"1:1", 1080, 1080, orientationSquare},
+		{"nearly square", 1080, 1060, orientationSquare},
+		{"zero width", 0, 1080, orientationOther},
+		{"zero height", 1920, 0, orientationOther},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := videoOrientation(media.Info{Width: tc.width, Height: tc.height})
+			if got != tc.want {
+				t.Errorf("videoOrientation(%dx%d) = %q, want %q", tc.width, tc.height, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+// Video grids show a short muted preview on hover and let viewers scrub
+// through a storyboard: a sprite sheet of frames at regular intervals, with a
+// WebVTT track mapping each interval to its tile. Both are stored next to
+// the video's other renditions.
+
+const (
+	previewFile   = "preview.mp4"
+	previewLength = 3 * time.Second
+	previewSize   = 320
+
+	storyboardSpriteFile = "storyboard.jpg"
+	storyboardTrackFile  = "storyboard.vtt"
+	storyboardTileSize   = 160
+	storyboardColumns    = 10
+	// maxStoryboardTiles caps the sprite sheet's size; longer videos get
+	// longer intervals between tiles instead.
+	maxStoryboardTiles = 100
+)
+
+// storePreviews generates the hover preview and storyboard of the video at
+// sourcePath, uploads them under keyPrefix and records them on video. Like
+// thumbnails, they aren't worth failing the video over, so errors are only
+// logged.
+func (cfg *apiConfig) storePreviews(ctx context.Context, video *database.Video, sourcePath, keyPrefix string, info media.Info) {
+	dir, err := os.MkdirTemp(cfg.processingDir, "previews-*")
+	if err != nil {
+		log.Printf("Couldn't create previews for video %s: %v", video.ID, err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	hasPreview := true
+	if err := cfg.createPreview(ctx, sourcePath, filepath.Join(dir, previewFile), info); err != nil {
+		log.Printf("Couldn't create preview for video %s: %v", video.ID, err)
+		hasPreview = false
+	}
+	hasStoryboard := true
+	if err := cfg.createStoryboard(ctx, sourcePath, dir, info); err != nil {
+		log.Printf("Couldn't create storyboard for video %s: %v", video.ID, err)
+		hasStoryboard = false
+	}
+	if !hasPreview && !hasStoryboard {
+		return
+	}
+
+	if err := cfg.uploadDir(ctx, dir, keyPrefix); err != nil {
+		log.Printf("Couldn't upload previews for video %s: %v", video.ID, err)
+		return
+	}
+	if hasPreview {
+		previewURL := storageRef(cfg.videoStore.Bucket(), keyPrefix+"/"+previewFile)
+		video.PreviewURL = &previewURL
+	}
+	if hasStoryboard {
+		storyboardURL := storageRef(cfg.videoStore.Bucket(), keyPrefix+"/"+storyboardTrackFile)
+		spriteURL := storageRef(cfg.videoStore.Bucket(), keyPrefix+"/"+storyboardSpriteFile)
+		video.StoryboardURL = &storyboardURL
+		video.StoryboardSpriteURL = &spriteURL
+	}
+}
+
+// createPreview encodes a few seconds from early in the video, skipping any
+// intro, as a small muted MP4.
+func (cfg *apiConfig) createPreview(ctx context.Context, sourcePath, outPath string, info media.Info) error {
+	duration := secondsToDuration(info.Duration)
+	start := time.Duration(0)
+	if duration > previewLength {
+		start = min(duration/10, duration-previewLength)
+	}
+
+	return cfg.media.Transcode(ctx, sourcePath, outPath, media.TranscodeOptions{
+		Format:     "mp4",
+		VideoCodec: "libx264",
+		Args: []string{
+			"-an",
+			"-vf", fitScale(previewSize, info),
+			"-preset", "veryfast", "-crf", "28", "-pix_fmt", "yuv420p",
+			"-movflags", "+faststart",
+		},
+		Start: start,
+		End:   start + previewLength,
+	})
+}
+
+// createStoryboard writes the storyboard sprite sheet and its WebVTT track
+// into dir. The track refers to the sprite by a relative URL.
+func (cfg *apiConfig) createStoryboard(ctx context.Context, sourcePath, dir string, info media.Info) error {
+	if info.Duration <= 0 {
+		return fmt.Errorf("video duration is unknown")
+	}
+	interval := max(1, int(math.Ceil(info.Duration/maxStoryboardTiles)))
+	tiles := int(math.Ceil(info.Duration / float64(interval)))
+	columns := min(tiles, storyboardColumns)
+	rows := (tiles + columns - 1) / columns
+	tileWidth, tileHeight := fitDimensions(storyboardTileSize, info)
+
+	err := cfg.media.Transcode(ctx, sourcePath, filepath.Join(dir, storyboardSpriteFile), media.TranscodeOptions{
+		Args: []string{
+			"-an",
+			"-vf", fmt.Sprintf("fps=1/%d,scale=%d:%d,tile=%dx%d", interval, tileWidth, tileHeight, columns, rows),
+			"-frames:v", "1", "-q:v", "4",
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	track := strings.Builder{}
+	track.WriteString("WEBVTT\n")
+	duration := secondsToDuration(info.Duration)
+	for i := 0; i < tiles; i++ {
+		start := time.Duration(i*interval) * time.Second
+		end := min(start+time.Duration(interval)*time.Second, duration)
+		fmt.Fprintf(&track, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(start), vttTimestamp(end), storyboardSpriteFile,
+			(i%columns)*tileWidth, (i/columns)*tileHeight, tileWidth, tileHeight)
+	}
+	return os.WriteFile(filepath.Join(dir, storyboardTrackFile), []byte(track.String()), 0o644)
+}
+
+// fitDimensions scales the video down so its longer side is size, keeping
+// both sides even as the H.264 encoder requires.
+func fitDimensions(size int, info media.Info) (int, int) {
+	if info.Height > info.Width {
+		return int(math.Round(float64(size)*float64(info.Width)/float64(info.Height)/2)) * 2, size
+	}
+	return size, int(math.Round(float64(size)*float64(info.Height)/float64(info.Width)/2)) * 2
+}
+
+func fitScale(size int, info media.Info) string {
+	width, height := fitDimensions(size, info)
+	return fmt.Sprintf("scale=%d:%d", width, height)
+}
+
+// vttTimestamp formats d as a WebVTT cue timestamp, HH:MM:SS.mmm.
+func vttTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+// Output formats the processing pipeline can produce for each video.
+const (
+	outputFormatMP4  = "mp4"
+	outputFormatHLS  = "hls"
+	outputFormatDASH = "dash"
+)
+
+var supportedOutputFormats = []string{outputFormatMP4, outputFormatHLS, outputFormatDASH}
+
+// segmentSeconds is the target segment length for the streaming formats.
+const segmentSeconds = 6
+
+// videoRendition is one rung of the adaptive bitrate ladder. Size is the
+// length of the video's shorter side, so a 720p rendition of a portrait
+// video is 720 pixels wide.
+type videoRendition struct {
+	Name         string
+	Size         int
+	VideoBitrate int // kbit/s
+	AudioBitrate int // kbit/s
+}
+
+var knownRenditions = []videoRendition{
+	{Name: "1080p", Size: 1080, VideoBitrate: 5000, AudioBitrate: 192},
+	{Name: "720p", Size: 720, VideoBitrate: 2800, AudioBitrate: 128},
+	{Name: "480p", Size: 480, VideoBitrate: 1400, AudioBitrate: 128},
+	{Name: "360p", Size: 360, VideoBitrate: 800, AudioBitrate: 96},
+	{Name: "240p", Size: 240, VideoBitrate: 400, AudioBitrate: 64},
+}
+
+const defaultVideoRenditions = "1080p,720p,480p,360p"
+
+func parseOutputFormats(value string) ([]string, error) {
+	formats := []string{}
+	for _, format := range strings.Split(value, ",") {
+		format = strings.ToLower(strings.TrimSpace(format))
+		if format == "" || slices.Contains(formats, format) {
+			continue
+		}
+		if !slices.Contains(supportedOutputFormats, format) {
+			return nil, fmt.Errorf("unsupported output format %q", format)
+		}
+		formats = append(formats, format)
+	}
+	if len(formats) == 0 {
+		return nil, fmt.Errorf("no output formats given")
+	}
+	return formats, nil
+}
+
+// parseVideoRenditions parses a comma separated list of rendition names such
+// as "1080p,720p", returning them largest first.
+func parseVideoRenditions(value string) ([]videoRendition, error) {
+	renditions := []videoRendition{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		i := slices.IndexFunc(knownRenditions, func(r videoRendition) bool { return r.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown rendition %q", name)
+		}
+		if !slices.Contains(renditions, knownRenditions[i]) {
+			renditions = append(renditions, knownRenditions[i])
+		}
+	}
+	if len(renditions) == 0 {
+		return nil, fmt.Errorf("no renditions given")
+	}
+	slices.SortFunc(renditions, func(a, b videoRendition) int { return b.Size - a.Size })
+	return renditions, nil
+}
+
+// renditionsForSource drops renditions that would upscale a video whose
+// shorter side is sourceSize pixels, always keeping at least the smallest.
+func renditionsForSource(renditions []videoRendition, sourceSize int) []videoRendition {
+	fitting := []videoRendition{}
+	for _, r := range renditions {
+		if r.Size <= sourceSize {
+			fitting = append(fitting, r)
+		}
+	}
+	if len(fitting) == 0 {
+		return renditions[len(renditions)-1:]
+	}
+	return fitting
+}
+
+// ladderOptions builds the transcode that encodes the source into
+// renditions and packages them, and returns it along with the file, inside
+// outDir, to write the output to.
+type ladderOptions func(outDir string, renditions []videoRendition, info media.Info) (string, media.TranscodeOptions)
+
+// transcodeLadder encodes the video at sourcePath into the renditions of
+// cfg.videoRenditions that fit it, packages them with buildOptions and uploads
+// the result under keyPrefix.
+func (cfg *apiConfig) transcodeLadder(ctx context.Context, sourcePath, keyPrefix, format string, buildOptions ladderOptions) error {
+	info, err := cfg.media.Probe(ctx, sourcePath)
+	if err != nil {
+		return fmt.Errorf("couldn't probe video: %w", err)
+	}
+	renditions := renditionsForSource(cfg.videoRenditions, min(info.Width, info.Height))
+
+	outDir, err := os.MkdirTemp(cfg.processingDir, strings.ToLower(format)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(outDir)
+
+	outPath, opts := buildOptions(outDir, renditions, info)
+	if err := cfg.media.Transcode(ctx, sourcePath, outPath, opts); err != nil {
+		return fmt.Errorf("couldn't transcode video to %s: %w", format, err)
+	}
+
+	if err := cfg.uploadDir(ctx, outDir, keyPrefix); err != nil {
+		return fmt.Errorf("couldn't upload %s rendition: %w", format, err)
+	}
+	return nil
+}
+
+// scaleFilter splits the source video into one scaled output per rendition,
+// labelled [v0], [v1], ...
+func scaleFilter(renditions []videoRendition, info media.Info) string {
+	filter := fmt.Sprintf("[0:v]split=%d", len(renditions))
+	for i := range renditions {
+		filter += fmt.Sprintf("[s%d]", i)
+	}
+	for i, r := range renditions {
+		scale := fmt.Sprintf("scale=-2:%d", r.Size)
+		if info.Height > info.Width {
+			scale = fmt.Sprintf("scale=%d:-2", r.Size)
+		}
+		filter += fmt.Sprintf(";[s%d]%s[v%d]", i, scale, i)
+	}
+	return filter
+}
+
+// encoderBitrateArgs caps the bitrate of output video stream i.
+func encoderBitrateArgs(i int, r videoRendition) []string {
+	return []string{
+		fmt.Sprintf("-b:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate),
+		fmt.Sprintf("-maxrate:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate*107/100),
+		fmt.Sprintf("-bufsize:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate*3/2),
+	}
+}
+
+// encoderArgs are the codec settings shared by every rendition. Keyframes are
+// forced on segment boundaries so every rendition can be switched between
+// at each segment.
+func encoderArgs(info media.Info) []string {
+	args := []string{
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-profile:v", "main",
+		"-pix_fmt", "yuv420p",
+		"-sc_threshold", "0",
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", segmentSeconds),
+	}
+	if info.HasAudio {
+		args = append(args, "-c:a", "aac", "-ac", "2")
+	}
+	return args
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+const (
+	storageBackendS3     = "s3"
+	storageBackendLocal  = "local"
+	storageBackendMemory = "memory"
+)
+
+type s3StoreOptions struct {
+	bucket      string
+	region      string
+	partSize    int64
+	concurrency int
+}
+
+// newStore builds the storage backend named by backend. root is only used by
+// the local backend, baseURL by the local and memory backends.
+func newStore(backend, root, baseURL string, s3Opts s3StoreOptions) (storage.Store, error) {
+	switch backend {
+	case storageBackendS3:
+		awsCfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(s3Opts.region))
+		if err != nil {
+			return nil, fmt.Errorf("couldn't load default AWS config: %w", err)
+		}
+		return storage.NewS3Store(s3.NewFromConfig(awsCfg), s3Opts.bucket, s3Opts.region, storage.S3Options{
+			PartSize:    s3Opts.partSize,
+			Concurrency: s3Opts.concurrency,
+		})
+	case storageBackendLocal:
+		return storage.NewLocalStore(root, baseURL)
+	case storageBackendMemory:
+		return storage.NewMemoryStore(baseURL), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/imaging"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/google/uuid"
+)
+
+// Thumbnails are decoded and re-encoded at a few standard sizes rather than
+// served as uploaded. Videos uploaded without a thumbnail get one extracted
+// from the video itself, either at a fixed timestamp or at the first scene
+// change.
+
+const (
+	thumbnailModeTimestamp = "timestamp"
+	thumbnailModeScene     = "scene"
+	thumbnailModeNone      = "none"
+
+	// sceneChangeThreshold is how different a frame must be from the one
+	// before it, from 0 to 1, to count as a scene change.
+	sceneChangeThreshold = 0.4
+)
+
+// thumbnailSize is a bounding box every thumbnail is resized to fit.
+type thumbnailSize struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+// thumbnailSizes are listed smallest first; the largest doubles as the
+// video's main thumbnail.
+var thumbnailSizes = []thumbnailSize{
+	{Name: "small", Width: 320, Height: 180},
+	{Name: "medium", Width: 640, Height: 360},
+	{Name: "large", Width: 1280, Height: 720},
+}
+
+// storeThumbnail re-encodes img in format at each of thumbnailSizes and
+// uploads the results to the asset store.
+func (cfg *apiConfig) storeThumbnail(ctx context.Context, videoID uuid.UUID, img image.Image, format string) ([]database.ThumbnailVariant, error) {
+	thumbnailID := make([]byte, 32)
+	rand.Read(thumbnailID)
+	baseKey := base64.RawURLEncoding.EncodeToString(thumbnailID)
+	ext := "png"
+	if format == imaging.FormatJPEG {
+		ext = "jpg"
+	}
+
+	variants := []database.ThumbnailVariant{}
+	for _, size := range thumbnailSizes {
+		resized := imaging.Fit(img, size.Width, size.Height)
+
+		var buf bytes.Buffer
+		if err := imaging.Encode(&buf, resized, format); err != nil {
+			cfg.releaseThumbnailVariants(variants)
+			return nil, err
+		}
+
+		key, err := cfg.storeBlob(ctx, cfg.assetStore, fmt.Sprintf("%s-%s.%s", baseKey, size.Name, ext), bytes.NewReader(buf.Bytes()), imaging.ContentType(format), "")
+		if err != nil {
+			cfg.releaseThumbnailVariants(variants)
+			return nil, fmt.Errorf("couldn't upload thumbnail to storage: %w", err)
+		}
+
+		variant := database.ThumbnailVariant{
+			VideoID: videoID,
+			Size:    size.Name,
+			Width:   resized.Bounds().Dx(),
+			Height:  resized.Bounds().Dy(),
+			URL:     storageRef(cfg.assetStore.Bucket(), key),
+		}
+
+		for _, alt := range cfg.thumbnailAlternates {
+			altKey, err := cfg.storeThumbnailAlternate(ctx, resized, alt, fmt.Sprintf("%s-%s.%s", baseKey, size.Name, alt.Ext))
+			if err != nil {
+				// The original format is always available to fall back on.
+				log.Printf("Couldn't encode %s thumbnail: %v", alt.Ext, err)
+				continue
+			}
+			altURL := storageRef(cfg.assetStore.Bucket(), altKey)
+			switch alt.Ext {
+			case "webp":
+				variant.WebPURL = &altURL
+			case "avif":
+				variant.AVIFURL = &altURL
+			}
+		}
+
+		variants = append(variants, variant)
+	}
+	return variants, nil
+}
+
+// imageAlternate is a newer image format thumbnails are also encoded in when
+// ffmpeg has an encoder for it. Stored next to the original with a different
+// extension, it is picked by the assets handler for clients that accept it.
+type imageAlternate struct {
+	Ext         string
+	ContentType string
+	Encoder     string
+	Args        []string
+}
+
+// imageAlternates are listed in order of preference.
+var imageAlternates = []imageAlternate{
+	{
+		Ext:         "avif",
+		ContentType: "image/avif",
+		Encoder:     "libaom-av1",
+		Args:        []string{"-still-picture", "1", "-crf", "32", "-cpu-used", "6"},
+	},
+	{
+		Ext:         "webp",
+		ContentType: "image/webp",
+		Encoder:     "libwebp",
+		Args:        []string{"-quality", "80"},
+	},
+}
+
+// detectImageAlternates returns the imageAlternates tool can encode.
+func detectImageAlternates(ctx context.Context, tool media.Tool) []imageAlternate {
+	encoders, err := tool.Encoders(ctx)
+	if err != nil {
+		return nil
+	}
+
+	available := []imageAlternate{}
+	for _, alt := range imageAlternates {
+		if slices.Contains(encoders, alt.Encoder) {
+			available = append(available, alt)
+		}
+	}
+	return available
+}
+
+// storeThumbnailAlternate encodes img as alt and uploads it to
+// the asset store under key, returning the key it is stored at.
+func (cfg *apiConfig) storeThumbnailAlternate(ctx context.Context, img image.Image, alt imageAlternate, key string) (string, error) {
+	// Hand the encoder a lossless copy so the image is only compressed once.
+	in, err := os.CreateTemp(cfg.processingDir, "thumbnail-*.png")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(in.Name())
+	err = imaging.Encode(in, img, imaging.FormatPNG)
+	in.Close()
+	if err != nil {
+		return "", err
+	}
+
+	outPath := strings.TrimSuffix(in.Name(), ".png") + "." + alt.Ext
+	defer os.Remove(outPath)
+	opts := media.TranscodeOptions{VideoCodec: alt.Encoder, Args: alt.Args}
+	if err := cfg.media.Transcode(ctx, in.Name(), outPath, opts); err != nil {
+		return "", err
+	}
+
+	out, err := os.Open(outPath)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	return cfg.storeBlob(ctx, cfg.assetStore, key, out, alt.ContentType, "")
+}
+
+// setThumbnail saves variants as the video's thumbnail, releasing the
+// variants they replace, or variants themselves if they can't be saved.
+func (cfg *apiConfig) setThumbnail(videoID uuid.UUID, variants []database.ThumbnailVariant) error {
+	replaced, err := cfg.db.SetThumbnailVariants(videoID, variants)
+	if err != nil {
+		cfg.releaseThumbnailVariants(variants)
+		return err
+	}
+	cfg.releaseThumbnailVariants(replaced)
+	return nil
+}
+
+// setDefaultThumbnail saves variants as the video's thumbnail unless it
+// already has one, such as one the user uploaded while the video was
+// processing, in which case variants are released.
+func (cfg *apiConfig) setDefaultThumbnail(videoID uuid.UUID, variants []database.ThumbnailVariant) error {
+	saved, err := cfg.db.SetDefaultThumbnailVariants(videoID, variants)
+	if err != nil || !saved {
+		cfg.releaseThumbnailVariants(variants)
+	}
+	return err
+}
+
+func (cfg *apiConfig) releaseThumbnailVariants(variants []database.ThumbnailVariant) {
+	for _, variant := range variants {
+		cfg.releaseBlob(cfg.assetStore, &variant.URL)
+		cfg.releaseBlob(cfg.assetStore, variant.WebPURL)
+		cfg.releaseBlob(cfg.assetStore, variant.AVIFURL)
+	}
+}
+
+// extractAndStoreThumbnail grabs a frame from the video at sourcePath and
+// stores it as the video's thumbnail variants. Scene mode falls back to the
+// configured timestamp if no scene change is found, and both fall back to
+// the first frame for videos shorter than the timestamp.
+func (cfg *apiConfig) extractAndStoreThumbnail(ctx context.Context, videoID uuid.UUID, sourcePath string) ([]database.ThumbnailVariant, error) {
+	framePath, err := cfg.extractThumbnailFrame(ctx, sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(framePath)
+
+	frame, err := os.ReadFile(framePath)
+	if err != nil {
+		return nil, err
+	}
+	img, format, err := imaging.Decode(frame)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.storeThumbnail(ctx, videoID, img, format)
+}
+
+func (cfg *apiConfig) extractThumbnailFrame(ctx context.Context, sourcePath string) (string, error) {
+	out, err := os.CreateTemp(cfg.processingDir, "thumbnail-*.jpg")
+	if err != nil {
+		return "", err
+	}
+	out.Close()
+
+	attempts := []media.FrameOptions{}
+	if cfg.thumbnailMode == thumbnailModeScene {
+		attempts = append(attempts, media.FrameOptions{SceneThreshold: sceneChangeThreshold})
+	}
+	attempts = append(attempts,
+		media.FrameOptions{At: cfg.thumbnailTimestamp},
+		media.FrameOptions{At: 0},
+	)
+
+	for _, opts := range attempts {
+		err = cfg.media.ExtractFrame(ctx, sourcePath, out.Name(), opts)
+		if !errors.Is(err, media.ErrNoFrame) {
+			break
+		}
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", fmt.Errorf("couldn't extract thumbnail: %w", err)
+	}
+	return out.Name(), nil
+}
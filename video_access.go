@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// getOwnedVideo authenticates the request and loads the video named by the
+// videoID path value. If the video can't be returned to the caller it writes
+// the error response and returns false.
+func (cfg *apiConfig) getOwnedVideo(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.Video{}, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Video{}, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.Video{}, false
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return database.Video{}, false
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "User does not own rights to this video.", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
+
+// respondWithVideo reloads video and returns it with client facing URLs.
+func (cfg *apiConfig) respondWithVideo(w http.ResponseWriter, r *http.Request, code int, videoID uuid.UUID) {
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+
+	signedVideo, err := cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign video URL", err)
+		return
+	}
+
+	respondWithJSON(w, code, signedVideo)
+}
+
+// startVideoUpload moves video to the uploading status, responding with a
+// conflict if it can't accept an upload right now.
+func (cfg *apiConfig) startVideoUpload(w http.ResponseWriter, video database.Video) bool {
+	err := cfg.db.TransitionVideoStatus(video.ID, database.VideoStatusUploading, "")
+	if errors.Is(err, database.ErrInvalidVideoTransition) {
+		respondWithError(w, http.StatusConflict, "Video can't be uploaded while it is "+string(video.Status), err)
+		return false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video status", err)
+		return false
+	}
+	return true
+}
+
+// cancelVideoUpload returns a video whose upload was abandoned to ready if it
+// still has an earlier upload attached, or to draft otherwise.
+func (cfg *apiConfig) cancelVideoUpload(videoID uuid.UUID) {
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil || video.ID == uuid.Nil || video.Status != database.VideoStatusUploading {
+		return
+	}
+	status := database.VideoStatusDraft
+	if video.VideoURL != nil {
+		status = database.VideoStatusReady
+	}
+	if err := cfg.db.TransitionVideoStatus(videoID, status, ""); err != nil {
+		log.Printf("Couldn't reset status of video %s: %v", videoID, err)
+	}
+}
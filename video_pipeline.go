@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/google/uuid"
+)
+
+const maxVideoUploadSize = 1 << 30 // 1 gigabyte
+
+// processAndStoreVideo turns the video at sourcePath, in any supported
+// container, into each of cfg.outputFormats, uploads them to the video store
+// and records their locations on video. Every upload path funnels into this
+// function. sourceHash is the SHA-256 of the source, if it was hashed while
+// it was staged.
+func (cfg *apiConfig) processAndStoreVideo(ctx context.Context, video database.Video, sourcePath, sourceHash string) error {
+	sourceProbe, err := cfg.media.Probe(ctx, sourcePath)
+	if err != nil {
+		return fmt.Errorf("couldn't probe video: %w", err)
+	}
+
+	// What this run stores is released if it fails, so that retries don't
+	// leak objects or blob references.
+	previous := video
+	saved := false
+	defer func() {
+		if !saved {
+			cfg.releaseVideoObjects(video, previous)
+		}
+	}()
+
+	// Cryptographically random 32-byte integer as base "id", under a prefix
+	// for the video's orientation
+	keyBase := make([]byte, 32)
+	rand.Read(keyBase)
+	baseKey := fmt.Sprintf("%s/%s", videoOrientation(sourceProbe), base64.RawURLEncoding.EncodeToString(keyBase))
+
+	// An original without the watermark is kept as a master, never
+	// returned to clients.
+	if cfg.keepOriginalVideo && cfg.watermark != nil {
+		key, err := cfg.storeVideoFile(ctx, sourcePath, baseKey+"/master", sourceHash)
+		if err != nil {
+			return fmt.Errorf("couldn't upload master video to storage: %w", err)
+		}
+		masterURL := storageRef(cfg.videoStore.Bucket(), key)
+		video.MasterURL = &masterURL
+	} else if cfg.keepOriginalVideo {
+		key, err := cfg.storeVideoFile(ctx, sourcePath, baseKey+"/original", sourceHash)
+		if err != nil {
+			return fmt.Errorf("couldn't upload original video to storage: %w", err)
+		}
+		originalURL := storageRef(cfg.videoStore.Bucket(), key)
+		video.OriginalURL = &originalURL
+	}
+
+	// Renditions and previews are made from publishPath, which has the
+	// watermark if there is one.
+	publishPath := sourcePath
+	if cfg.watermark != nil {
+		publishPath, err = cfg.applyWatermark(ctx, sourcePath, sourceProbe)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(publishPath)
+	}
+
+	// Record the metadata of the MP4 viewers will get, or of the source if
+	// there is no MP4.
+	probe := sourceProbe
+	if slices.Contains(cfg.outputFormats, outputFormatMP4) {
+		var key string
+		key, probe, err = cfg.storeNormalizedMP4(ctx, publishPath, baseKey)
+		if err != nil {
+			return err
+		}
+		videoURL := storageRef(cfg.videoStore.Bucket(), key)
+		video.VideoURL = &videoURL
+	}
+
+	if slices.Contains(cfg.outputFormats, outputFormatHLS) {
+		key, err := cfg.transcodeAndStoreHLS(ctx, publishPath, baseKey+"/hls")
+		if err != nil {
+			return err
+		}
+		playlistURL := storageRef(cfg.videoStore.Bucket(), key)
+		video.HLSPlaylistURL = &playlistURL
+	}
+
+	if slices.Contains(cfg.outputFormats, outputFormatDASH) {
+		key, err := cfg.transcodeAndStoreDASH(ctx, publishPath, baseKey+"/dash")
+		if err != nil {
+			return err
+		}
+		manifestURL := storageRef(cfg.videoStore.Bucket(), key)
+		video.DASHManifestURL = &manifestURL
+	}
+
+	if cfg.audioRendition != audioRenditionNone && sourceProbe.HasAudio {
+		key, err := cfg.storeAudioRendition(ctx, publishPath, baseKey+"/audio")
+		if err != nil {
+			return err
+		}
+		audioURL := storageRef(cfg.videoStore.Bucket(), key)
+		video.AudioURL = &audioURL
+	}
+
+	// Keep any thumbnail the user uploaded while the video was processing.
+	current, err := cfg.db.GetVideo(video.ID)
+	if err != nil {
+		return err
+	}
+	if current.ID == uuid.Nil {
+		return errJobVideoDeleted
+	}
+
+	if current.ThumbnailURL == nil && cfg.thumbnailMode != thumbnailModeNone {
+		variants, err := cfg.extractAndStoreThumbnail(ctx, video.ID, sourcePath)
+		if err != nil {
+			// A missing thumbnail isn't worth failing the video over.
+			log.Printf("Couldn't create thumbnail for video %s: %v", video.ID, err)
+		} else if err := cfg.setDefaultThumbnail(video.ID, variants); err != nil {
+			return err
+		}
+	}
+
+	if cfg.generatePreviews {
+		cfg.storePreviews(ctx, &video, publishPath, baseKey, sourceProbe)
+	}
+	cfg.storeEmbeddedCaptions(ctx, video.ID, sourcePath, sourceProbe)
+
+	if err := cfg.db.SetVideoMetadata(video.ID, videoMetadata(probe)); err != nil {
+		return err
+	}
+	err = cfg.db.SetVideoRenditions(video)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errJobVideoDeleted
+	}
+	if err != nil {
+		return err
+	}
+	// The video refers to what this run stored now, and whatever it
+	// referred to before is released. If the video is deleted from here on,
+	// deleting it releases what this run stored.
+	saved = true
+	cfg.releaseVideoObjects(previous, video)
+
+	err = cfg.db.TransitionVideoStatus(video.ID, database.VideoStatusReady, "")
+	if errors.Is(err, sql.ErrNoRows) {
+		return errJobVideoDeleted
+	}
+	return err
+}
+
+// storeNormalizedMP4 converts the video at sourcePath to a web-playable MP4
+// and uploads it next to baseKey, returning its key and probe.
+func (cfg *apiConfig) storeNormalizedMP4(ctx context.Context, sourcePath, baseKey string) (string, media.Info, error) {
+	processedPath, err := cfg.normalizeToMP4(ctx, sourcePath)
+	if err != nil {
+		return "", media.Info{}, fmt.Errorf("couldn't convert video to MP4: %w", err)
+	}
+	defer os.Remove(processedPath)
+
+	probe, err := cfg.media.Probe(ctx, processedPath)
+	if err != nil {
+		return "", media.Info{}, fmt.Errorf("couldn't probe converted video: %w", err)
+	}
+
+	key, err := cfg.storeVideoFile(ctx, processedPath, baseKey, "")
+	if err != nil {
+		return "", media.Info{}, fmt.Errorf("couldn't upload video to storage: %w", err)
+	}
+	return key, probe, nil
+}
+
+// storeVideoFile uploads the video at path to baseKey plus the extension of
+// its type. The object is stored with the type its bytes show, not one we
+// assume. hash is the file's SHA-256, if it is known already.
+func (cfg *apiConfig) storeVideoFile(ctx context.Context, path, baseKey, hash string) (string, error) {
+	contentType, err := sniffFile(path)
+	if err != nil {
+		return "", err
+	}
+	ext, ok := videoExtensions[contentType]
+	if !ok {
+		return "", fmt.Errorf("unexpected video type %s", contentType)
+	}
+	key := baseKey + ext
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return cfg.storeBlob(ctx, cfg.videoStore, key, f, contentType, hash)
+}
+
+// generatedContentTypes maps the files written by the streaming packagers
+// and preview generators to the content types players expect.
+var generatedContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+	".mpd":  "application/dash+xml",
+	".m4s":  "video/iso.segment",
+	".mp4":  "video/mp4",
+	".jpg":  "image/jpeg",
+	".vtt":  "text/vtt",
+}
+
+// uploadDir uploads every file under dir to the video store, keyed by its
+// path relative to dir under keyPrefix.
+func (cfg *apiConfig) uploadDir(ctx context.Context, dir, keyPrefix string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		contentType, ok := generatedContentTypes[filepath.Ext(path)]
+		if !ok {
+			contentType = "application/octet-stream"
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return cfg.videoStore.Put(ctx, keyPrefix+"/"+filepath.ToSlash(rel), f, contentType)
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// Video and thumbnail URLs are stored in the database as "bucket,key"
+// references and only turned into URLs when a video is returned to a client.
+
+const (
+	cfSigningURL    = "url"
+	cfSigningCookie = "cookie"
+)
+
+func storageRef(bucket, key string) string {
+	return fmt.Sprintf("%s,%s", bucket, key)
+}
+
+func parseStorageRef(ref string) (bucket, key string, ok bool) {
+	bucket, key, ok = strings.Cut(ref, ",")
+	if !ok || bucket == "" || key == "" {
+		return "", "", false
+	}
+	return bucket, key, true
+}
+
+// publishedMediaOnly answers requests for staged uploads and masters, which
+// are in the video store but never meant to be fetched, with a 404.
+func publishedMediaOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/")
+		if strings.HasPrefix(key, directUploadPrefix) || strings.HasPrefix(path.Base(key), "master.") {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (cfg *apiConfig) dbVideoToSignedVideo(ctx context.Context, video database.Video) (database.Video, error) {
+	var err error
+	video.VideoURL, err = cfg.resolveStorageURL(ctx, cfg.videoStore, video.VideoURL)
+	if err != nil {
+		return database.Video{}, err
+	}
+	video.OriginalURL, err = cfg.resolveStorageURL(ctx, cfg.videoStore, video.OriginalURL)
+	if err != nil {
+		return database.Video{}, err
+	}
+	video.HLSPlaylistURL, err = cfg.resolveStorageURL(ctx, cfg.videoStore, video.HLSPlaylistURL)
+	if err != nil {
+		return database.Video{}, err
+	}
+	video.DASHManifestURL, err = cfg.resolveStorageURL(ctx, cfg.videoStore, video.DASHManifestURL)
+	if err != nil {
+		return database.Video{}, err
+	}
+	video.AudioURL, err = cfg.resolveStorageURL(ctx, cfg.videoStore, video.AudioURL)
+	if err != nil {
+		return database.Video{}, err
+	}
+	video.PreviewURL, err = cfg.resolveStorageURL(ctx, cfg.videoStore, video.PreviewURL)
+	if err != nil {
+		return database.Video{}, err
+	}
+	video.StoryboardURL, err = cfg.resolveStorageURL(ctx, cfg.videoStore, video.StoryboardURL)
+	if err != nil {
+		return database.Video{}, err
+	}
+	video.StoryboardSpriteURL, err = cfg.resolveStorageURL(ctx, cfg.videoStore, video.StoryboardSpriteURL)
+	if err != nil {
+		return database.Video{}, err
+	}
+	video.ThumbnailURL, err = cfg.resolveStorageURL(ctx, cfg.assetStore, video.ThumbnailURL)
+	if err != nil {
+		return database.Video{}, err
+	}
+	variants := make([]database.ThumbnailVariant, len(video.ThumbnailVariants))
+	for i, variant := range video.ThumbnailVariants {
+		resolved, err := cfg.resolveStorageURL(ctx, cfg.assetStore, &variant.URL)
+		if err != nil {
+			return database.Video{}, err
+		}
+		variant.URL = *resolved
+		variant.WebPURL, err = cfg.resolveStorageURL(ctx, cfg.assetStore, variant.WebPURL)
+		if err != nil {
+			return database.Video{}, err
+		}
+		variant.AVIFURL, err = cfg.resolveStorageURL(ctx, cfg.assetStore, variant.AVIFURL)
+		if err != nil {
+			return database.Video{}, err
+		}
+		variants[i] = variant
+	}
+	video.ThumbnailVariants = variants
+
+	captions := make([]database.Caption, len(video.Captions))
+	for i, caption := range video.Captions {
+		resolved, err := cfg.resolveStorageURL(ctx, cfg.videoStore, &caption.URL)
+		if err != nil {
+			return database.Video{}, err
+		}
+		caption.URL = *resolved
+		captions[i] = caption
+	}
+	video.Captions = captions
+	return video, nil
+}
+
+// resolveStorageURL turns a stored reference into a URL a client can fetch.
+// Objects in S3 are served through CloudFront when CloudFront signing is
+// configured, otherwise through a presigned URL, so links always expire.
+func (cfg *apiConfig) resolveStorageURL(ctx context.Context, store storage.Store, ref *string) (*string, error) {
+	if ref == nil {
+		return nil, nil
+	}
+
+	bucket, key, ok := parseStorageRef(*ref)
+	if !ok {
+		// Rows written before references were introduced hold a full URL.
+		return ref, nil
+	}
+	if bucket != store.Bucket() {
+		return nil, fmt.Errorf("object %q is stored in unknown bucket %q", key, bucket)
+	}
+
+	if _, isS3 := store.(*storage.S3Store); isS3 && cfg.cfSigner != nil {
+		cdnURL := fmt.Sprintf("https://%s/%s", cfg.s3CfDistribution, key)
+		if cfg.cfSigningMode == cfSigningCookie {
+			return &cdnURL, nil
+		}
+		signedURL, err := cfg.cfSigner.SignURL(cdnURL, time.Now().Add(cfg.videoURLExpiry))
+		if err != nil {
+			return nil, err
+		}
+		return &signedURL, nil
+	}
+
+	presignedURL, err := store.PresignGet(ctx, key, cfg.videoURLExpiry)
+	if err != nil {
+		return nil, err
+	}
+	return &presignedURL, nil
+}
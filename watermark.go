@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+// Published videos can carry a logo burned into the picture. The watermark
+// is applied to a copy of the upload before any rendition is made from it,
+// so every rendition and preview shows it; the un-watermarked upload is only
+// kept, privately, when originals are kept.
+
+const (
+	watermarkTopLeft     = "top-left"
+	watermarkTopRight    = "top-right"
+	watermarkBottomLeft  = "bottom-left"
+	watermarkBottomRight = "bottom-right"
+	watermarkCenter      = "center"
+
+	// watermarkMargin is the gap between the watermark and the edges of the
+	// video, as a fraction of its shorter side.
+	watermarkMargin = 0.03
+)
+
+var watermarkPositions = []string{watermarkTopLeft, watermarkTopRight, watermarkBottomLeft, watermarkBottomRight, watermarkCenter}
+
+// watermark is an image overlaid on every published video. Scale is its
+// width as a fraction of the video's.
+type watermark struct {
+	Path     string
+	Width    int
+	Height   int
+	Position string
+	Opacity  float64
+	Scale    float64
+}
+
+// loadWatermark reads the watermark image at path and checks the rest of its
+// configuration. Empty settings take their defaults.
+func loadWatermark(path, position, opacity, scale string) (*watermark, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode watermark image, which must be PNG or JPEG: %w", err)
+	}
+
+	w := &watermark{
+		Path:     path,
+		Width:    config.Width,
+		Height:   config.Height,
+		Position: watermarkBottomRight,
+		Opacity:  0.8,
+		Scale:    0.15,
+	}
+	if position != "" {
+		if !slices.Contains(watermarkPositions, position) {
+			return nil, fmt.Errorf("position must be one of %v", watermarkPositions)
+		}
+		w.Position = position
+	}
+	if opacity != "" {
+		w.Opacity, err = strconv.ParseFloat(opacity, 64)
+		if err != nil || w.Opacity <= 0 || w.Opacity > 1 {
+			return nil, fmt.Errorf("opacity must be greater than 0 and at most 1: %v", opacity)
+		}
+	}
+	if scale != "" {
+		w.Scale, err = strconv.ParseFloat(scale, 64)
+		if err != nil || w.Scale <= 0 || w.Scale > 1 {
+			return nil, fmt.Errorf("scale must be greater than 0 and at most 1: %v", scale)
+		}
+	}
+	return w, nil
+}
+
+// applyWatermark writes a copy of the video at sourcePath with cfg.watermark
+// burned in to a new file and returns its path. The copy is an H.264 MP4
+// like normalizeToMP4's, so the MP4 rendition made from it is only remuxed.
+func (cfg *apiConfig) applyWatermark(ctx context.Context, sourcePath string, info media.Info) (string, error) {
+	outPath := fmt.Sprintf("%s.watermarked", sourcePath)
+	audioCodec := "aac"
+	if !info.HasAudio || info.AudioCodec == "aac" {
+		audioCodec = "copy"
+	}
+
+	err := cfg.media.Transcode(ctx, sourcePath, outPath, media.TranscodeOptions{
+		Format:     "mp4",
+		Inputs:     []string{cfg.watermark.Path},
+		Filter:     cfg.watermark.filter(info),
+		VideoCodec: "libx264",
+		AudioCodec: audioCodec,
+		Args: []string{
+			"-map", "[v]", "-map", "0:a:0?",
+			"-preset", "veryfast", "-crf", "18", "-pix_fmt", "yuv420p",
+			"-movflags", "+faststart",
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("couldn't apply watermark: %w", err)
+	}
+	return outPath, nil
+}
+
+// filter scales the watermark, input 1, to the video and overlays it on
+// input 0, labelling the result [v].
+func (w watermark) filter(info media.Info) string {
+	width := evenRound(float64(info.Width) * w.Scale)
+	height := evenRound(float64(width) * float64(w.Height) / float64(w.Width))
+	margin := int(float64(min(info.Width, info.Height)) * watermarkMargin)
+
+	// In overlay's expressions W and H are the video's size, w and h the
+	// watermark's.
+	var x, y string
+	switch w.Position {
+	case watermarkTopLeft:
+		x, y = fmt.Sprint(margin), fmt.Sprint(margin)
+	case watermarkTopRight:
+		x, y = fmt.Sprintf("W-w-%d", margin), fmt.Sprint(margin)
+	case watermarkBottomLeft:
+		x, y = fmt.Sprint(margin), fmt.Sprintf("H-h-%d", margin)
+	case watermarkCenter:
+		x, y = "(W-w)/2", "(H-h)/2"
+	default:
+		x, y = fmt.Sprintf("W-w-%d", margin), fmt.Sprintf("H-h-%d", margin)
+	}
+
+	return fmt.Sprintf("[1:v]format=rgba,scale=%d:%d,colorchannelmixer=aa=%g[wm];[0:v][wm]overlay=%s:%s[v]",
+		width, height, w.Opacity, x, y)
+}
+
+func evenRound(f float64) int {
+	return max(2, int(math.Round(f/2))*2)
+}